@@ -0,0 +1,152 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the default prefix of environment variables.
+const DefaultEnvPrefix = "HTTPSRVTPL_"
+
+// LoadFile merges the config file into c. The format is decided by the extension of path,
+// one of .yaml, .yml, .toml and .json. An unknown key is an error, so typos are not
+// ignored silently.
+func (c *Config) LoadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &m)
+	case ".toml":
+		err = toml.Unmarshal(b, &m)
+	case ".json":
+		err = json.Unmarshal(b, &m)
+	default:
+		return fmt.Errorf("unknown config file format %s", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s failed: %v", path, err)
+	}
+
+	byKey := map[string]Field{}
+	for _, f := range c.Fields() {
+		byKey[f.Key] = f
+	}
+	return mergeMap(byKey, m, "")
+}
+
+// mergeMap sets the fields of byKey with the values of m whose keys are prefixed by
+// prefix.
+func mergeMap(byKey map[string]Field, m map[string]interface{}, prefix string) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := prefix + k
+		f, ok := byKey[key]
+		if !ok {
+			section, isSection := m[k].(map[string]interface{})
+			if !isSection || !hasPrefix(byKey, key+".") {
+				return fmt.Errorf("unknown config key %s", key)
+			}
+			err := mergeMap(byKey, section, key+".")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := setValue(f, m[k])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// hasPrefix reports whether any key of byKey has prefix.
+func hasPrefix(byKey map[string]Field, prefix string) bool {
+	for key := range byKey {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setValue sets the field with a value decoded from a config file.
+func setValue(f Field, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		f.value.Set(reflect.Zero(f.value.Type()))
+		return nil
+	case string:
+		return f.Set(v)
+	case []interface{}:
+		if f.value.Kind() != reflect.Slice {
+			return fmt.Errorf("list is given to %s", f.value.Type())
+		}
+		list := []string{}
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%v is not a string", item)
+			}
+			list = append(list, s)
+		}
+		return f.SetList(list)
+	case map[string]interface{}:
+		if f.value.Kind() != reflect.Map {
+			return fmt.Errorf("table is given to %s", f.value.Type())
+		}
+		list := []string{}
+		for k, item := range v {
+			list = append(list, fmt.Sprintf("%s=%v", k, item))
+		}
+		return f.SetList(list)
+	}
+	if f.value.Type() == durationType {
+		return fmt.Errorf("duration %v must be a string like 5s", v)
+	}
+	if f.IsList() {
+		return fmt.Errorf("%v is given to %s", v, f.value.Type())
+	}
+	return f.Set(fmt.Sprint(v))
+}
+
+// LoadEnv merges the environment variables into c. A variable is named by prefix and the
+// flag name in upper snake case, e.g. HTTPSRVTPL_DATABASE_DSN. lookup is usually
+// os.LookupEnv.
+func (c *Config) LoadEnv(prefix string, lookup func(key string) (string, bool)) error {
+	for _, f := range c.Fields() {
+		name := EnvName(prefix, f.Name)
+		v, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		err := f.Set(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// EnvName returns the name of the environment variable of a flag.
+func EnvName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `
+address: 127.0.0.1:9000
+read-timeout: 3s
+database:
+  type: sqlite3
+  dsn: test.db
+  max-open-conns: 4
+handlers:
+  debug: false
+access-log:
+  exclude: [/ping, /metrics]
+  sample:
+    /api/v1/items: 0.1
+`,
+		"config.toml": `
+address = "127.0.0.1:9000"
+read-timeout = "3s"
+
+[database]
+type = "sqlite3"
+dsn = "test.db"
+max-open-conns = 4
+
+[handlers]
+debug = false
+
+[access-log]
+exclude = ["/ping", "/metrics"]
+sample = { "/api/v1/items" = 0.1 }
+`,
+		"config.json": `{
+  "address": "127.0.0.1:9000",
+  "read-timeout": "3s",
+  "database": {"type": "sqlite3", "dsn": "test.db", "max-open-conns": 4},
+  "handlers": {"debug": false},
+  "access-log": {"exclude": ["/ping", "/metrics"], "sample": {"/api/v1/items": 0.1}}
+}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		assert.Nil(t, err, "should be nil")
+
+		c := Default()
+		err = c.LoadFile(path)
+		assert.Nil(t, err, name)
+		assert.Equal(t, "127.0.0.1:9000", c.Address, name)
+		assert.Equal(t, 3*time.Second, c.ReadTimeout, name)
+		assert.Equal(t, 30*time.Second, c.WriteTimeout, name)
+		assert.Equal(t, "sqlite3", c.Database.Type, name)
+		assert.Equal(t, "test.db", c.Database.DSN, name)
+		assert.Equal(t, 4, c.Database.MaxOpenConns, name)
+		assert.Equal(t, 2, c.Database.MaxIdleConns, name)
+		assert.Equal(t, false, c.Handlers.Debug, name)
+		assert.Equal(t, true, c.Handlers.Ping, name)
+		assert.Equal(t, []string{"/ping", "/metrics"}, c.AccessLog.Exclude, name)
+		assert.Equal(t, map[string]float64{"/api/v1/items": 0.1}, c.AccessLog.Sample, name)
+	}
+
+	// Test invalid files
+	invalidFiles := map[string]string{
+		"unknown.yaml":     "adress: 127.0.0.1:9000\n",
+		"unknown-sub.yaml": "database:\n  dns: test.db\n",
+		"section.yaml":     "database: sqlite3\n",
+		"duration.yaml":    "read-timeout: 3\n",
+		"list.yaml":        "access-log:\n  exclude: /ping\n  format: [json]\n",
+		"syntax.json":      "{",
+		"config.ini":       "address=127.0.0.1:9000",
+	}
+	for name, content := range invalidFiles {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		assert.Nil(t, err, "should be nil")
+
+		err = Default().LoadFile(path)
+		assert.NotNil(t, err, name)
+	}
+	err := Default().LoadFile(filepath.Join(dir, "nothing.yaml"))
+	assert.NotNil(t, err, "should not be nil")
+}
+
+func TestLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"APP_ADDRESS":              "127.0.0.1:9000",
+		"APP_DATABASE_DSN":         "test.db",
+		"APP_TLS_CIPHER_SUITES":    "TLS_AES_128_GCM_SHA256,TLS_AES_256_GCM_SHA384",
+		"APP_HANDLERS_PING":        "false",
+		"APP_RATE_LIMIT_PERIOD":    "1s",
+		"HTTPSRVTPL_WRITE_TIMEOUT": "1s",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	c := Default()
+	err := c.LoadEnv("APP_", lookup)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "127.0.0.1:9000", c.Address, "should be equal")
+	assert.Equal(t, "test.db", c.Database.DSN, "should be equal")
+	assert.Equal(t, []string{"TLS_AES_128_GCM_SHA256", "TLS_AES_256_GCM_SHA384"}, c.TLS.CipherSuites, "should be equal")
+	assert.Equal(t, false, c.Handlers.Ping, "should be equal")
+	assert.Equal(t, time.Second, c.RateLimit.Period, "should be equal")
+	assert.Equal(t, 30*time.Second, c.WriteTimeout, "should be equal")
+
+	env["APP_HANDLERS_PING"] = "no"
+	err = Default().LoadEnv("APP_", lookup)
+	assert.NotNil(t, err, "should not be nil")
+
+	assert.Equal(t, "HTTPSRVTPL_ACCESS_LOG_FORMAT", EnvName(DefaultEnvPrefix, "access-log-format"), "should be equal")
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	"github.com/mikunalpha/httpsrvtpl/server"
+)
+
+// ServerOptions maps c onto the options of server.New. The address is given to
+// server.New, and the store is created from c.Database by the caller. c should be
+// validated first. The files opened for the options are closed by the shutdown hooks, or
+// before returning an error.
+func (c *Config) ServerOptions() (opts []server.Option, err error) {
+	closers := []io.Closer{}
+	defer func() {
+		if err != nil {
+			for _, closer := range closers {
+				closer.Close()
+			}
+		}
+	}()
+
+	opts = []server.Option{
+		server.OptReadTimeout(c.ReadTimeout),
+		server.OptReadHeaderTimeout(c.ReadHeaderTimeout),
+		server.OptWriteTimeout(c.WriteTimeout),
+		server.OptIdleTimeout(c.IdleTimeout),
+		server.OptMaxHeaderBytes(c.MaxHeaderBytes),
+		server.OptShutdownTimeout(c.ShutdownTimeout),
+		server.OptShutdownDelay(c.ShutdownDelay),
+		server.OptErrorFormat(server.ErrorFormat(c.ErrorFormat)),
+		server.OptProblemTypeBaseURI(c.ProblemTypeBaseURI),
+	}
+	for _, address := range c.Listen {
+		opts = append(opts, server.OptListen(address))
+	}
+	opts = append(opts, c.handlerOptions()...)
+	opts = append(opts, c.adminOptions()...)
+
+	tlsOpts, err := c.tlsOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, tlsOpts...)
+
+	if c.AccessLog.Format != "" {
+		out, closer := logging.OpenOutput(logging.Config{
+			Output:     c.AccessLog.Output,
+			MaxSize:    c.Log.MaxSize,
+			MaxAge:     c.Log.MaxAge,
+			MaxBackups: c.Log.MaxBackups,
+		})
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+		opts = append(opts, server.OptAccessLog(server.AccessLogConfig{
+			Format:       c.AccessLog.Format,
+			Output:       out,
+			ExcludePaths: c.AccessLog.Exclude,
+			SampleRates:  c.AccessLog.Sample,
+		}))
+	}
+
+	rc := c.ReloadConfig()
+	if rc.CORS != nil {
+		opts = append(opts, server.OptCORS(*rc.CORS))
+	}
+	if rc.RateLimit != nil {
+		opts = append(opts, server.OptRateLimit(*rc.RateLimit))
+	}
+
+	if c.MessagesDir != "" {
+		mc := server.NewMessageCatalog(c.DefaultLocale)
+		err = mc.LoadDir(c.MessagesDir)
+		if err != nil {
+			return nil, fmt.Errorf("load messages failed: %v", err)
+		}
+		opts = append(opts, server.OptMessageCatalog(mc))
+	}
+
+	if c.ExposePanicStack {
+		opts = append(opts, server.OptExposePanicStack())
+	}
+	if c.PanicReportFile != "" {
+		reporter, err := server.NewFilePanicReporter(c.PanicReportFile)
+		if err != nil {
+			return nil, fmt.Errorf("open panic report file failed: %v", err)
+		}
+		closers = append(closers, reporter)
+		opts = append(opts, server.OptPanicReporter(reporter))
+	}
+
+	if len(closers) > 0 {
+		opts = append(opts, server.OptOnShutdown(func() {
+			for _, closer := range closers {
+				closer.Close()
+			}
+		}))
+	}
+	return opts, nil
+}
+
+// handlerOptions returns the options of the enabled built-in handlers.
+func (c *Config) handlerOptions() []server.Option {
+	opts := []server.Option{}
+	if c.Handlers.MethodOverride {
+		opts = append(opts, server.OptAllowMethodOverride())
+	}
+	if c.Handlers.Ping {
+		opts = append(opts, server.OptAddPingHandler())
+	}
+	if c.Handlers.Health {
+		opts = append(opts, server.OptAddHealthHandler())
+	}
+	if c.Handlers.Metrics {
+		opts = append(opts, server.OptMetrics())
+	}
+	if c.Handlers.Debug {
+		opts = append(opts, server.OptAddDebugHandler())
+	}
+	return opts
+}
+
+// adminOptions returns the options of admin routes.
+func (c *Config) adminOptions() []server.Option {
+	opts := []server.Option{}
+	if c.Admin.Address != "" {
+		opts = append(opts, server.OptAdminAddress(c.Admin.Address))
+	}
+	if c.Admin.Token != "" {
+		opts = append(opts, server.OptAdminToken(c.Admin.Token))
+	}
+	if c.Admin.BasicAuthUsername != "" {
+		opts = append(opts, server.OptAdminBasicAuth(c.Admin.BasicAuthUsername, c.Admin.BasicAuthPassword))
+	}
+	if len(c.Admin.AllowIP) > 0 {
+		opts = append(opts, server.OptAdminAllowIPs(c.Admin.AllowIP...))
+	}
+	return opts
+}
+
+// tlsOptions returns the options of HTTPS, or nothing if tls.cert-file is empty.
+func (c *Config) tlsOptions() ([]server.Option, error) {
+	if c.TLS.CertFile == "" {
+		return nil, nil
+	}
+
+	opts := []server.Option{
+		server.OptTLS(c.TLS.CertFile, c.TLS.KeyFile),
+		server.OptTLSMinVersion(tlsVersions[c.TLS.MinVersion]),
+	}
+	if len(c.TLS.CipherSuites) > 0 {
+		suites := []uint16{}
+		for _, name := range c.TLS.CipherSuites {
+			id, _ := cipherSuiteID(name)
+			suites = append(suites, id)
+		}
+		opts = append(opts, server.OptTLSCipherSuites(suites...))
+	}
+
+	if c.TLS.ClientCAFile != "" {
+		caPEM, err := ioutil.ReadFile(c.TLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls client ca file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no any certificate in %s", c.TLS.ClientCAFile)
+		}
+		opts = append(opts, server.OptTLSClientAuth(pool, tlsClientAuthTypes[c.TLS.ClientAuth]))
+	}
+	return opts, nil
+}
+
+// ReloadConfig maps the settings which server.Reload applies onto server.ReloadConfig.
+// The log levels are applied by the caller with LogConfig.
+func (c *Config) ReloadConfig() server.ReloadConfig {
+	rc := server.ReloadConfig{}
+	if len(c.CORS.AllowOrigin) > 0 {
+		rc.CORS = &server.CORSConfig{
+			AllowOrigins:     c.CORS.AllowOrigin,
+			AllowHeaders:     c.CORS.AllowHeader,
+			ExposeHeaders:    c.CORS.ExposeHeader,
+			AllowCredentials: c.CORS.AllowCredentials,
+			MaxAge:           c.CORS.MaxAge,
+		}
+	}
+	if c.RateLimit.Requests > 0 {
+		cfg := c.rateLimitConfig()
+		rc.RateLimit = &cfg
+	}
+	return rc
+}
+
+// LogConfig maps the log settings onto logging.Config. debug sets the level to debug.
+func (c *Config) LogConfig() logging.Config {
+	cfg := logging.Config{
+		Level:      c.Log.Level,
+		Format:     c.Log.Format,
+		Output:     c.Log.Output,
+		MaxSize:    c.Log.MaxSize,
+		MaxAge:     c.Log.MaxAge,
+		MaxBackups: c.Log.MaxBackups,
+		ComponentLevels: map[string]string{
+			logging.ComponentServer: c.Log.ServerLevel,
+			logging.ComponentStore:  c.Log.StoreLevel,
+		},
+	}
+	if c.Debug {
+		cfg.Level = "debug"
+	}
+	return cfg
+}
+
+// rateLimitConfig returns the config of the default rate limit.
+func (c *Config) rateLimitConfig() server.RateLimitConfig {
+	cfg := server.RateLimitConfig{
+		Limit:   c.RateLimit.Requests,
+		Period:  c.RateLimit.Period,
+		Burst:   c.RateLimit.Burst,
+		Key:     server.RateLimitByIP(),
+		Shared:  c.RateLimit.Shared,
+		MaxKeys: c.RateLimit.MaxKeys,
+	}
+	if strings.HasPrefix(c.RateLimit.Key, "header:") {
+		cfg.Key = server.RateLimitByHeader(strings.TrimPrefix(c.RateLimit.Key, "header:"))
+	}
+	return cfg
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikunalpha/httpsrvtpl/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerOptions(t *testing.T) {
+	c := Default()
+	opts, err := c.ServerOptions()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 13, len(opts), "should be equal")
+
+	c.Handlers = HandlersConfig{}
+	c.Admin.Token = "secret"
+	c.CORS.AllowOrigin = []string{"*"}
+	c.RateLimit.Requests = 10
+	c.AccessLog.Format = "json"
+	c.Listen = []string{"tcp://127.0.0.1:8888", "unix:///run/httpsrvtpl.sock"}
+	opts, err = c.ServerOptions()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 15, len(opts), "should be equal")
+
+	// Test reloadable settings
+	rc := Default().ReloadConfig()
+	assert.Nil(t, rc.CORS, "should be nil")
+	assert.Nil(t, rc.RateLimit, "should be nil")
+	rc = c.ReloadConfig()
+	assert.Equal(t, []string{"*"}, rc.CORS.AllowOrigins, "should be equal")
+	assert.Equal(t, 10, rc.RateLimit.Limit, "should be equal")
+
+	// Test log settings
+	c.Debug = true
+	c.Log.StoreLevel = "trace"
+	lc := c.LogConfig()
+	assert.Equal(t, "debug", lc.Level, "should be equal")
+	assert.Equal(t, "trace", lc.ComponentLevels["store"], "should be equal")
+	assert.Equal(t, "", lc.ComponentLevels["server"], "should be equal")
+
+	// Test files of outputs
+	dir := t.TempDir()
+	c = Default()
+	c.AccessLog.Format = "json"
+	c.AccessLog.Output = filepath.Join(dir, "access.log")
+	c.PanicReportFile = filepath.Join(dir, "panic.log")
+	opts, err = c.ServerOptions()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 16, len(opts), "should be equal")
+	s := server.New("127.0.0.1:0", opts...)
+	err = s.Run()
+	assert.Nil(t, err, "should be nil")
+	resp, err := http.Get("http://" + s.Addr().String() + "/ping")
+	assert.Nil(t, err, "should be nil")
+	resp.Body.Close()
+	s.Stop()
+	b, err := ioutil.ReadFile(c.AccessLog.Output)
+	assert.Nil(t, err, "should be nil")
+	assert.Contains(t, string(b), `"path":"/ping"`, "should contain")
+
+	c.PanicReportFile = filepath.Join(dir, "nothing", "panic.log")
+	_, err = c.ServerOptions()
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test files which can not be read
+	c = Default()
+	c.TLS.CertFile = "cert.pem"
+	c.TLS.KeyFile = "key.pem"
+	c.TLS.ClientCAFile = filepath.Join(t.TempDir(), "nothing.pem")
+	_, err = c.ServerOptions()
+	assert.NotNil(t, err, "should not be nil")
+
+	c = Default()
+	c.MessagesDir = filepath.Join(t.TempDir(), "nothing")
+	_, err = c.ServerOptions()
+	assert.NotNil(t, err, "should not be nil")
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tlsVersions are the values of tls.min-version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsClientAuthTypes are the values of tls.client-auth.
+var tlsClientAuthTypes = map[string]tls.ClientAuthType{
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+// Validate checks c, and returns an error listing all invalid settings.
+func (c *Config) Validate() error {
+	problems := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Address != "", "address is empty")
+	for _, address := range c.Listen {
+		scheme := "tcp"
+		if i := strings.Index(address, "://"); i >= 0 {
+			scheme = address[:i]
+		}
+		check(scheme == "tcp" || scheme == "unix" || scheme == "fd", "unknown scheme of listen %s", address)
+	}
+	check(c.ReadTimeout >= 0, "read-timeout is negative")
+	check(c.ReadHeaderTimeout >= 0, "read-header-timeout is negative")
+	check(c.WriteTimeout >= 0, "write-timeout is negative")
+	check(c.IdleTimeout >= 0, "idle-timeout is negative")
+	check(c.MaxHeaderBytes >= 0, "max-header-bytes is negative")
+	check(c.ShutdownTimeout >= 0, "shutdown-timeout is negative")
+	check(c.ShutdownDelay >= 0, "shutdown-delay is negative")
+
+	switch c.Database.Type {
+	case "mock":
+	case "postgres", "sqlite3":
+		check(c.Database.DSN != "", "database.dsn is required by database type %s", c.Database.Type)
+	default:
+		check(false, "unknown database.type %s", c.Database.Type)
+	}
+	check(c.Database.MaxOpenConns >= 0, "database.max-open-conns is negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max-idle-conns is negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn-max-lifetime is negative")
+	check(c.Database.PingRetries >= 0, "database.ping-retries is negative")
+
+	check(c.TLS.CertFile != "" || c.TLS.KeyFile == "", "tls.cert-file is required by tls.key-file")
+	check(c.TLS.CertFile == "" || c.TLS.KeyFile != "", "tls.key-file is required by tls.cert-file")
+	check(c.TLS.CertFile != "" || c.TLS.ClientCAFile == "", "tls.cert-file is required by tls.client-ca-file")
+	_, ok := tlsVersions[c.TLS.MinVersion]
+	check(ok, "unknown tls.min-version %s", c.TLS.MinVersion)
+	for _, name := range c.TLS.CipherSuites {
+		_, ok := cipherSuiteID(name)
+		check(ok, "unknown tls.cipher-suites %s", name)
+	}
+	_, ok = tlsClientAuthTypes[c.TLS.ClientAuth]
+	check(ok, "unknown tls.client-auth %s", c.TLS.ClientAuth)
+
+	switch c.AccessLog.Format {
+	case "", "json", "logfmt", "combined":
+	default:
+		check(false, "unknown access-log.format %s", c.AccessLog.Format)
+	}
+	check(c.AccessLog.Output != "", "access-log.output is empty")
+	for route, rate := range c.AccessLog.Sample {
+		check(rate >= 0 && rate <= 1, "access-log.sample of %s is not between 0 and 1", route)
+	}
+
+	_, err := log.ParseLevel(c.Log.Level)
+	check(err == nil, "unknown log.level %s", c.Log.Level)
+	for key, level := range map[string]string{"log.server-level": c.Log.ServerLevel, "log.store-level": c.Log.StoreLevel} {
+		_, err := log.ParseLevel(level)
+		check(level == "" || err == nil, "unknown %s %s", key, level)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		check(false, "unknown log.format %s", c.Log.Format)
+	}
+	check(c.Log.Output != "", "log.output is empty")
+	check(c.Log.MaxSize >= 0, "log.max-size is negative")
+	check(c.Log.MaxAge >= 0, "log.max-age is negative")
+	check(c.Log.MaxBackups >= 0, "log.max-backups is negative")
+
+	if c.Handlers.Debug {
+		host, _, _ := net.SplitHostPort(c.Admin.Address)
+		ip := net.ParseIP(host)
+		loopback := strings.EqualFold(host, "localhost") || (ip != nil && ip.IsLoopback())
+		guarded := loopback || c.Admin.Token != "" || c.Admin.BasicAuthUsername != "" || len(c.Admin.AllowIP) > 0
+		check(guarded, "admin routes need a loopback admin.address, admin.token, admin.basic-auth-username or admin.allow-ip")
+	}
+	check(!c.Handlers.Reload || c.Admin.Token != "" || c.Admin.BasicAuthUsername != "", "admin.token or admin.basic-auth-username is required by handlers.reload")
+	check(c.Admin.BasicAuthUsername == "" || c.Admin.BasicAuthPassword != "", "admin.basic-auth-password is required by admin.basic-auth-username")
+	for _, cidr := range c.Admin.AllowIP {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil || net.ParseIP(cidr) != nil, "invalid admin.allow-ip %s", cidr)
+	}
+
+	for _, origin := range c.CORS.AllowOrigin {
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allow-credentials cannot be used with cors.allow-origin *")
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max-age is negative")
+
+	check(c.RateLimit.Requests >= 0, "rate-limit.requests is negative")
+	check(c.RateLimit.Burst >= 0, "rate-limit.burst is negative")
+	check(c.RateLimit.MaxKeys >= 0, "rate-limit.max-keys is negative")
+	if c.RateLimit.Requests > 0 {
+		check(c.RateLimit.Period > 0, "rate-limit.period must be positive")
+		key := c.RateLimit.Key
+		check(key == "ip" || (strings.HasPrefix(key, "header:") && len(key) > len("header:")), "unknown rate-limit.key %s", key)
+	}
+
+	switch c.ErrorFormat {
+	case "envelope", "problem", "negotiate":
+	default:
+		check(false, "unknown error-format %s", c.ErrorFormat)
+	}
+	check(c.MessagesDir == "" || c.DefaultLocale != "", "default-locale is required by messages-dir")
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// cipherSuiteID returns the ID of the cipher suite named name.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	err := Default().Validate()
+	assert.Nil(t, err, "should be nil")
+	c := Default()
+	c.Handlers.Debug = true
+	c.Admin.AllowIP = []string{"127.0.0.1", "10.0.0.0/8"}
+	err = c.Validate()
+	assert.Nil(t, err, "should be nil")
+	c = Default()
+	c.Handlers.Debug = true
+	c.Handlers.Reload = true
+	c.Admin.Address = "localhost:6060"
+	c.Admin.BasicAuthUsername = "admin"
+	c.Admin.BasicAuthPassword = "pass"
+	err = c.Validate()
+	assert.Nil(t, err, "should be nil")
+
+	type testCase struct {
+		Modify   func(c *Config)
+		Expected string
+	}
+	testCases := []testCase{
+		{func(c *Config) { c.Address = "" }, "address is empty"},
+		{func(c *Config) { c.Listen = []string{"unix:///run/a.sock", "udp://:53"} }, "unknown scheme of listen udp://:53"},
+		{func(c *Config) { c.ReadTimeout = -1 }, "read-timeout is negative"},
+		{func(c *Config) { c.Database.Type = "mysql" }, "unknown database.type mysql"},
+		{func(c *Config) { c.Database.Type = "postgres" }, "database.dsn is required by database type postgres"},
+		{func(c *Config) { c.TLS.CertFile = "cert.pem" }, "tls.key-file is required by tls.cert-file"},
+		{func(c *Config) { c.TLS.ClientCAFile = "ca.pem" }, "tls.cert-file is required by tls.client-ca-file"},
+		{func(c *Config) { c.TLS.MinVersion = "1.4" }, "unknown tls.min-version 1.4"},
+		{func(c *Config) { c.TLS.CipherSuites = []string{"TLS_NOTHING"} }, "unknown tls.cipher-suites TLS_NOTHING"},
+		{func(c *Config) { c.TLS.ClientAuth = "never" }, "unknown tls.client-auth never"},
+		{func(c *Config) { c.AccessLog.Format = "xml" }, "unknown access-log.format xml"},
+		{func(c *Config) { c.AccessLog.Sample = map[string]float64{"/a": 2} }, "access-log.sample of /a is not between 0 and 1"},
+		{func(c *Config) { c.AccessLog.Output = "" }, "access-log.output is empty"},
+		{func(c *Config) { c.Log.Level = "verbose" }, "unknown log.level verbose"},
+		{func(c *Config) { c.Log.StoreLevel = "verbose" }, "unknown log.store-level verbose"},
+		{func(c *Config) { c.Log.Format = "xml" }, "unknown log.format xml"},
+		{func(c *Config) { c.Log.MaxAge = -1 }, "log.max-age is negative"},
+		{func(c *Config) { c.Handlers.Debug = true }, "admin routes need a loopback admin.address, admin.token, admin.basic-auth-username or admin.allow-ip"},
+		{func(c *Config) { c.Handlers.Debug = true; c.Admin.Address = "0.0.0.0:6060" }, "admin routes need a loopback admin.address, admin.token, admin.basic-auth-username or admin.allow-ip"},
+		{func(c *Config) { c.Handlers.Reload = true; c.Admin.Address = "127.0.0.1:6060" }, "admin.token or admin.basic-auth-username is required by handlers.reload"},
+		{func(c *Config) { c.Handlers.Reload = true; c.Admin.AllowIP = []string{"10.0.0.0/8"} }, "admin.token or admin.basic-auth-username is required by handlers.reload"},
+		{func(c *Config) { c.Admin.BasicAuthUsername = "admin" }, "admin.basic-auth-password is required by admin.basic-auth-username"},
+		{func(c *Config) { c.Admin.AllowIP = []string{"10.0.0.0/33"} }, "invalid admin.allow-ip 10.0.0.0/33"},
+		{func(c *Config) { c.CORS.AllowOrigin = []string{"*"}; c.CORS.AllowCredentials = true }, "cors.allow-credentials cannot be used with cors.allow-origin *"},
+		{func(c *Config) { c.RateLimit.MaxKeys = -1 }, "rate-limit.max-keys is negative"},
+		{func(c *Config) { c.RateLimit.Requests = 10; c.RateLimit.Period = 0 }, "rate-limit.period must be positive"},
+		{func(c *Config) { c.RateLimit.Requests = 10; c.RateLimit.Key = "header:" }, "unknown rate-limit.key header:"},
+		{func(c *Config) { c.ErrorFormat = "xml" }, "unknown error-format xml"},
+	}
+	for _, tc := range testCases {
+		c := Default()
+		tc.Modify(c)
+		err := c.Validate()
+		if assert.NotNil(t, err, tc.Expected) {
+			assert.Equal(t, "invalid config: "+tc.Expected, err.Error(), "should be equal")
+		}
+	}
+
+	// Test all problems are listed
+	c = Default()
+	c.Address = ""
+	c.ErrorFormat = "xml"
+	err = c.Validate()
+	assert.NotNil(t, err, "should not be nil")
+	assert.Equal(t, 2, len(strings.Split(err.Error(), "; ")), "should be equal")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+var configCommand = cli.Command{
+	Name:  "config",
+	Usage: "inspect the configuration",
+	Subcommands: []cli.Command{
+		{
+			Name:  "print",
+			Usage: "print the effective configuration with secrets redacted",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Value: "yaml",
+					Usage: "output format, one of yaml, toml and json",
+				},
+			},
+			Action: configPrintAction,
+		},
+	},
+}
+
+// configPrintAction prints the effective config, which can be used as a config file. It
+// fails after printing if the config is invalid.
+func configPrintAction(c *cli.Context) error {
+	cfg := appConfig(c)
+	m := cfg.Map(true)
+
+	var (
+		b   []byte
+		err error
+	)
+	switch c.String("format") {
+	case "yaml":
+		b, err = yaml.Marshal(m)
+	case "toml":
+		b, err = toml.Marshal(m)
+	case "json":
+		b, err = json.MarshalIndent(m, "", "  ")
+		b = append(b, '\n')
+	default:
+		return fmt.Errorf("unknown format %s", c.String("format"))
+	}
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(b)
+
+	return cfg.Validate()
+}
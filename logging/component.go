@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The components which have their own loggers.
+const (
+	ComponentServer = "server"
+	ComponentStore  = "store"
+)
+
+var components = struct {
+	mu        sync.RWMutex
+	loggers   map[string]*log.Logger
+	overrides map[string]log.Level
+}{
+	loggers:   map[string]*log.Logger{},
+	overrides: map[string]log.Level{},
+}
+
+// Component returns the logger of the component name. Its entries carry the component
+// field, and are written by the formatter, the output and the hooks of the standard
+// logger. Its level is the override of the component, or the level of the standard
+// logger if there is no override.
+//
+// The loggers of components copy the settings of the standard logger when they are
+// changed by Setup, SetLevel or SetLevels. Call Sync after changing the standard logger
+// directly, e.g. by log.SetOutput or log.AddHook.
+func Component(name string) *log.Entry {
+	components.mu.Lock()
+	defer components.mu.Unlock()
+	l, ok := components.loggers[name]
+	if !ok {
+		l = log.New()
+		components.loggers[name] = l
+		syncComponent(name, l)
+	}
+	return l.WithField("component", name)
+}
+
+// Sync applies the formatter, the output, the hooks, the caller reporting and the level
+// of the standard logger to the loggers of components. The overrides of components are
+// kept.
+func Sync() {
+	components.mu.Lock()
+	defer components.mu.Unlock()
+	for name, l := range components.loggers {
+		syncComponent(name, l)
+	}
+}
+
+// syncComponent applies the settings of the standard logger and the level of the
+// component to l. The caller must hold components.mu.
+func syncComponent(name string, l *log.Logger) {
+	std := log.StandardLogger()
+	hooks := make(log.LevelHooks)
+	for level, hs := range std.Hooks {
+		hooks[level] = append([]log.Hook{}, hs...)
+	}
+	level, ok := components.overrides[name]
+	if !ok {
+		level = std.GetLevel()
+	}
+
+	l.SetFormatter(std.Formatter)
+	l.SetOutput(std.Out)
+	l.ReplaceHooks(hooks)
+	l.SetReportCaller(std.ReportCaller)
+	l.SetLevel(level)
+}
+
+// Components returns the names of the components which have loggers, in order.
+func Components() []string {
+	components.mu.RLock()
+	defer components.mu.RUnlock()
+	names := []string{}
+	for name := range components.loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ComponentLevel returns the level of the component, and whether it is overridden.
+func ComponentLevel(name string) (log.Level, bool) {
+	components.mu.RLock()
+	defer components.mu.RUnlock()
+	if level, ok := components.overrides[name]; ok {
+		return level, true
+	}
+	return log.GetLevel(), false
+}
+
+// SetComponentLevel overrides the level of the component.
+func SetComponentLevel(name string, level log.Level) {
+	components.mu.Lock()
+	defer components.mu.Unlock()
+	overrides := map[string]log.Level{name: level}
+	for n, l := range components.overrides {
+		if n != name {
+			overrides[n] = l
+		}
+	}
+	components.overrides = overrides
+	if l, ok := components.loggers[name]; ok {
+		syncComponent(name, l)
+	}
+}
+
+// ResetComponentLevel removes the override of the component, which follows the level of
+// the standard logger again.
+func ResetComponentLevel(name string) {
+	components.mu.Lock()
+	defer components.mu.Unlock()
+	overrides := map[string]log.Level{}
+	for n, l := range components.overrides {
+		if n != name {
+			overrides[n] = l
+		}
+	}
+	components.overrides = overrides
+	if l, ok := components.loggers[name]; ok {
+		syncComponent(name, l)
+	}
+}
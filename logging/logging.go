@@ -0,0 +1,137 @@
+// Package logging configures the standard logger of logrus, and provides the loggers of
+// components, e.g. server and store, whose levels can be overridden at runtime.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Config contains the settings of the standard logger.
+type Config struct {
+	// Level is a level of logrus, e.g. debug, info or warning. Default is info.
+	Level string
+	// Format is text or json. Default is text.
+	Format string
+	// Output is stdout, stderr or the path of a file. Default is stdout.
+	Output string
+	// MaxSize is the size in megabytes a file output is rotated at. 0 means 100MB.
+	MaxSize int
+	// MaxAge is how many days rotated files are kept. 0 means forever.
+	MaxAge int
+	// MaxBackups is how many rotated files are kept. 0 means all.
+	MaxBackups int
+	// ComponentLevels overrides the level of components, e.g. store=debug.
+	ComponentLevels map[string]string
+}
+
+var output struct {
+	mu     sync.Mutex
+	closer io.Closer
+}
+
+// Setup configures the standard logger and the loggers of components by cfg. The file of
+// the previous Setup is closed.
+func Setup(cfg Config) error {
+	var formatter log.Formatter
+	switch cfg.Format {
+	case "", "text":
+		formatter = &log.TextFormatter{}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %s", cfg.Format)
+	}
+
+	out, closer := OpenOutput(cfg)
+	err := SetLevels(cfg.Level, cfg.ComponentLevels)
+	if err != nil {
+		return err
+	}
+	log.SetFormatter(formatter)
+	log.SetOutput(out)
+	Sync()
+
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	if output.closer != nil {
+		output.closer.Close()
+	}
+	output.closer = closer
+	return nil
+}
+
+// OpenOutput returns the writer of cfg.Output, which is rotated by the sizes of cfg if it
+// is a file. The closer is nil for stdout and stderr.
+func OpenOutput(cfg Config) (io.Writer, io.Closer) {
+	switch cfg.Output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	f := &lumberjack.Logger{
+		Filename:   cfg.Output,
+		MaxSize:    cfg.MaxSize,
+		MaxAge:     cfg.MaxAge,
+		MaxBackups: cfg.MaxBackups,
+		LocalTime:  true,
+	}
+	return f, f
+}
+
+// Close closes the file output of Setup, if any.
+func Close() error {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	if output.closer == nil {
+		return nil
+	}
+	err := output.closer.Close()
+	output.closer = nil
+	return err
+}
+
+// SetLevel sets the level of the standard logger, which the components without overrides
+// follow.
+func SetLevel(level log.Level) {
+	log.SetLevel(level)
+	Sync()
+}
+
+// SetLevels sets the level of the standard logger, and replaces the overrides of
+// components with levels, including the ones set by SetComponentLevel. Nothing is changed
+// if any level is invalid.
+func SetLevels(level string, levels map[string]string) error {
+	lvl := log.InfoLevel
+	if level != "" {
+		var err error
+		lvl, err = log.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+	}
+	overrides := map[string]log.Level{}
+	for name, level := range levels {
+		if level == "" {
+			continue
+		}
+		l, err := log.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("%s of component %s", err, name)
+		}
+		overrides[name] = l
+	}
+
+	log.SetLevel(lvl)
+	components.mu.Lock()
+	components.overrides = overrides
+	components.mu.Unlock()
+	Sync()
+	return nil
+}
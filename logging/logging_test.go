@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetup(t *testing.T) {
+	defer func(out io.Writer, formatter log.Formatter, level log.Level) {
+		log.SetOutput(out)
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+	}(log.StandardLogger().Out, log.StandardLogger().Formatter, log.GetLevel())
+
+	// Test file output in JSON
+	path := filepath.Join(t.TempDir(), "app.log")
+	err := Setup(Config{Level: "warning", Format: "json", Output: path, MaxSize: 1})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, log.WarnLevel, log.GetLevel(), "should be equal")
+	log.Info("info")
+	log.Warn("warn")
+	err = Close()
+	assert.Nil(t, err, "should be nil")
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 1, strings.Count(string(b), "\n"), "should be equal")
+	assert.Contains(t, string(b), `"msg":"warn"`, "should contain")
+
+	// Test defaults
+	err = Setup(Config{})
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, log.InfoLevel, log.GetLevel(), "should be equal")
+	assert.Equal(t, os.Stdout, log.StandardLogger().Out, "should be equal")
+
+	// Test invalid settings change nothing
+	err = Setup(Config{Format: "xml"})
+	assert.NotNil(t, err, "should not be nil")
+	err = Setup(Config{Level: "verbose", Output: "stderr"})
+	assert.NotNil(t, err, "should not be nil")
+	err = Setup(Config{ComponentLevels: map[string]string{"store": "verbose"}, Output: "stderr"})
+	assert.NotNil(t, err, "should not be nil")
+	assert.Equal(t, os.Stdout, log.StandardLogger().Out, "should be equal")
+}
+
+func TestComponent(t *testing.T) {
+	defer func(out io.Writer, level log.Level) {
+		log.SetOutput(out)
+		SetLevels(level.String(), nil)
+	}(log.StandardLogger().Out, log.GetLevel())
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	Sync()
+
+	logger := Component("test")
+	assert.Contains(t, Components(), "test", "should contain")
+
+	// Test the component follows the standard logger
+	SetLevel(log.InfoLevel)
+	logger.Debug("debug")
+	logger.Info("info")
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "should be equal")
+	assert.Contains(t, out.String(), "component=test", "should contain")
+	assert.Equal(t, false, logger.Logger.IsLevelEnabled(log.DebugLevel), "should be equal")
+
+	// Test the component shares the hooks and the caller reporting after Sync
+	hook := &countHook{}
+	log.AddHook(hook)
+	log.SetReportCaller(true)
+	Sync()
+	out.Reset()
+	logger.Info("info")
+	assert.Equal(t, 1, hook.count, "should be equal")
+	assert.Contains(t, out.String(), "func=", "should contain")
+	log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	log.SetReportCaller(false)
+	Sync()
+
+	level, overridden := ComponentLevel("test")
+	assert.Equal(t, log.InfoLevel, level, "should be equal")
+	assert.Equal(t, false, overridden, "should be equal")
+
+	// Test the override of the component
+	out.Reset()
+	SetComponentLevel("test", log.DebugLevel)
+	logger.Debug("debug")
+	log.Debug("debug")
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "should be equal")
+	level, overridden = ComponentLevel("test")
+	assert.Equal(t, log.DebugLevel, level, "should be equal")
+	assert.Equal(t, true, overridden, "should be equal")
+	assert.Equal(t, true, logger.Logger.IsLevelEnabled(log.DebugLevel), "should be equal")
+
+	// Test the override is kept when the standard level changes
+	SetLevel(log.WarnLevel)
+	assert.Equal(t, true, logger.Logger.IsLevelEnabled(log.DebugLevel), "should be equal")
+	SetLevel(log.InfoLevel)
+
+	out.Reset()
+	SetComponentLevel("test", log.ErrorLevel)
+	logger.Warn("warn")
+	assert.Equal(t, "", out.String(), "should be equal")
+
+	// Test the override is removed
+	ResetComponentLevel("test")
+	logger.Warn("warn")
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "should be equal")
+
+	// Test SetLevels replaces the overrides
+	SetComponentLevel("test", log.DebugLevel)
+	err := SetLevels("warning", map[string]string{"other": "debug"})
+	assert.Nil(t, err, "should be nil")
+	level, overridden = ComponentLevel("test")
+	assert.Equal(t, log.WarnLevel, level, "should be equal")
+	assert.Equal(t, false, overridden, "should be equal")
+	level, _ = ComponentLevel("other")
+	assert.Equal(t, log.DebugLevel, level, "should be equal")
+}
+
+// countHook counts the entries it fires for.
+type countHook struct {
+	count int
+}
+
+func (h *countHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *countHook) Fire(entry *log.Entry) error {
+	h.count++
+	return nil
+}
@@ -4,9 +4,17 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/mikunalpha/httpsrvtpl/config"
+	"github.com/mikunalpha/httpsrvtpl/logging"
 	"github.com/mikunalpha/httpsrvtpl/store"
 	"github.com/mikunalpha/httpsrvtpl/store/mock"
+	"github.com/mikunalpha/httpsrvtpl/store/sqlstore"
 
 	"github.com/mikunalpha/httpsrvtpl/server"
 	log "github.com/sirupsen/logrus"
@@ -15,24 +23,32 @@ import (
 
 var version = "v0.1.2"
 
-var flags = []cli.Flag{
-	cli.StringFlag{
-		Name:   "address",
-		Value:  "0.0.0.0:8888",
-		Usage:  "server will listen on the address",
-		EnvVar: "_ADDRESS",
-	},
-	cli.StringFlag{
-		Name:   "database-type",
-		Value:  "mock",
-		Usage:  "database type",
-		EnvVar: "_DATABASE_TYPE",
-	},
-	cli.BoolFlag{
-		Name:   "debug",
-		Usage:  "show debug message",
-		EnvVar: "_DEBUG",
-	},
+// flags are the flags of config.Config, plus the ones deciding where it is loaded from.
+func flags() []cli.Flag {
+	fs := []cli.Flag{
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "config file in YAML, TOML or JSON, it is overridden by environment variables and flags",
+		},
+		cli.StringFlag{
+			Name:  "env-prefix",
+			Value: config.DefaultEnvPrefix,
+			Usage: "prefix of environment variables, e.g. HTTPSRVTPL_DATABASE_DSN sets --database-dsn",
+		},
+	}
+	for _, f := range config.Default().Fields() {
+		switch {
+		case f.IsBool() && f.Value().(bool):
+			fs = append(fs, cli.BoolTFlag{Name: f.Name, Usage: f.Usage})
+		case f.IsBool():
+			fs = append(fs, cli.BoolFlag{Name: f.Name, Usage: f.Usage})
+		case f.IsList():
+			fs = append(fs, cli.StringSliceFlag{Name: f.Name, Usage: f.Usage})
+		default:
+			fs = append(fs, cli.StringFlag{Name: f.Name, Value: f.String(), Usage: f.Usage})
+		}
+	}
+	return fs
 }
 
 func init() {
@@ -40,47 +56,185 @@ func init() {
 	log.SetLevel(log.InfoLevel)
 }
 
-func newStore(c *cli.Context) (store.Store, error) {
-	switch c.GlobalString("database-type") {
+// loadConfig merges the defaults, the config file, the environment variables and the
+// flags in order. It does not validate the result.
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	cfg := config.Default()
+	if path := c.GlobalString("config"); path != "" {
+		err := cfg.LoadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("load config file failed: %v", err)
+		}
+	}
+	err := cfg.LoadEnv(c.GlobalString("env-prefix"), os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range cfg.Fields() {
+		if !c.GlobalIsSet(f.Name) {
+			continue
+		}
+		switch {
+		case f.IsBool():
+			err = f.Set(strconv.FormatBool(c.GlobalBool(f.Name)))
+		case f.IsList():
+			err = f.SetList(c.GlobalStringSlice(f.Name))
+		default:
+			err = f.Set(c.GlobalString(f.Name))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %v", f.Name, err)
+		}
+	}
+	return cfg, nil
+}
+
+func newStore(cfg config.DatabaseConfig) (store.Store, error) {
+	switch cfg.Type {
 	case "mock":
 		return mock.New(), nil
+	case "postgres", "sqlite3":
+		return sqlstore.New(sqlstore.Config{
+			Driver:          cfg.Type,
+			DSN:             cfg.DSN,
+			MaxOpenConns:    cfg.MaxOpenConns,
+			MaxIdleConns:    cfg.MaxIdleConns,
+			ConnMaxLifetime: cfg.ConnMaxLifetime,
+			PingRetries:     cfg.PingRetries,
+			PingBackoff:     time.Second,
+		})
+	}
+	return nil, fmt.Errorf("unknow database type %s", cfg.Type)
+}
+
+func before(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	c.App.Metadata["config"] = cfg
+	err = logging.Setup(cfg.LogConfig())
+	if err != nil {
+		return fmt.Errorf("setup log failed: %v", err)
 	}
-	return nil, fmt.Errorf("unknow database type %s", c.GlobalString("database-type"))
+	return nil
+}
+
+// appConfig returns the config loaded by before.
+func appConfig(c *cli.Context) *config.Config {
+	return c.App.Metadata["config"].(*config.Config)
+}
+
+// reloader reloads the config for SIGHUP and POST /admin/reload.
+type reloader struct {
+	mu  sync.Mutex
+	c   *cli.Context
+	cfg *config.Config
+	s   *server.Server
+}
+
+// reload loads the config again and applies the reloadable settings to the server. The
+// server keeps the old settings if the config is invalid. Changes of the other settings
+// are logged, and they are applied after restarting. The log levels are set only if they
+// are changed, so the ones set by PUT /debug/loglevel are kept otherwise. A change of any
+// level replaces all of them, including the runtime overrides of other components.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := loadConfig(r.c)
+	if err != nil {
+		return err
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return err
+	}
+	err = r.s.Reload(cfg.ReloadConfig())
+	if err != nil {
+		return err
+	}
+	old, lc := r.cfg.LogConfig(), cfg.LogConfig()
+	if old.Level != lc.Level || !reflect.DeepEqual(old.ComponentLevels, lc.ComponentLevels) {
+		err = logging.SetLevels(lc.Level, lc.ComponentLevels)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.cfg.Changed(cfg) {
+		if f.Reload {
+			log.Infof("%s is reloaded", f.Key)
+		} else {
+			log.Warnf("%s is changed, it is applied after restarting", f.Key)
+		}
+	}
+	r.cfg = cfg
+	return nil
 }
 
 func action(c *cli.Context) error {
-	if c.GlobalIsSet("debug") {
-		log.SetLevel(log.DebugLevel)
+	cfg := appConfig(c)
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+
+	opts, err := cfg.ServerOptions()
+	if err != nil {
+		return err
 	}
 
-	st, err := newStore(c)
+	st, err := newStore(cfg.Database)
 	if err != nil {
 		return fmt.Errorf("newStore failed: %v", err)
 	}
+	opts = append(opts, server.OptStore(st), server.OptOnShutdown(st.Close))
 
-	opts := []server.Option{
-		server.OptStore(st),
-		server.OptAllowMethodOverride(),
-		server.OptAddPingHandler(),
-		server.OptAddDebugHandler(),
+	r := &reloader{c: c, cfg: cfg}
+	if cfg.Handlers.Reload {
+		opts = append(opts, server.OptAddReloadHandler(r.reload))
 	}
 
-	stop := make(chan os.Signal)
-	signal.Notify(stop, os.Interrupt)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
-	s := server.New(c.GlobalString("address"), opts...)
-	s.Run()
+	s := server.New(cfg.Address, opts...)
+	r.s = s
+	err = s.Run()
+	if err != nil {
+		return fmt.Errorf("run server failed: %v", err)
+	}
 
-	<-stop
+	for running := true; running; {
+		select {
+		case <-reload:
+			log.Info("receive SIGHUP, reloading config")
+			err = r.reload()
+			if err != nil {
+				log.Errorf("reload config failed, keep the old one: %v", err)
+			}
+		case sig := <-stop:
+			log.Infof("receive %s, shutting down", sig)
+			running = false
+		case <-s.Done():
+			return fmt.Errorf("server stopped unexpectedly: %v", s.Err())
+		}
+	}
 
-	return s.Stop()
+	summary, err := s.Stop()
+	log.Infof("server stopped in %s: %d connections drained, %d force closed", summary.Duration, summary.Drained, summary.ForceClosed)
+	return err
 }
 
 func main() {
 	app := cli.NewApp()
 	app.Name = "httpsrvtpl"
 	app.Usage = "HTTPSRVTPL IS AWESOME"
-	app.UsageText = "httpsrvtpl [options]"
+	app.UsageText = "httpsrvtpl [options] [command]"
 	app.Version = version
 	app.Copyright = "(c) 2018 mikun800527@gmail.com"
 	app.HideHelp = true
@@ -88,11 +242,20 @@ func main() {
 		cli.ShowAppHelp(c)
 		return nil
 	}
-	app.Flags = flags
+	app.Flags = flags()
+	app.Metadata = map[string]interface{}{}
+	app.Before = before
 	app.Action = action
+	app.Commands = []cli.Command{
+		migrateCommand,
+		configCommand,
+	}
 
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Error(err)
+		logging.Close()
+		os.Exit(1)
 	}
+	logging.Close()
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mikunalpha/httpsrvtpl/store/sqlstore"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var migrateCommand = cli.Command{
+	Name:  "migrate",
+	Usage: "migrate the schema of database",
+	Subcommands: []cli.Command{
+		{
+			Name:   "up",
+			Usage:  "apply all pending migrations",
+			Action: migrateUpAction,
+		},
+		{
+			Name:      "down",
+			Usage:     "revert the latest N applied migrations",
+			ArgsUsage: "N",
+			Action:    migrateDownAction,
+		},
+		{
+			Name:   "status",
+			Usage:  "show the status of migrations",
+			Action: migrateStatusAction,
+		},
+	},
+}
+
+func newSQLStore(c *cli.Context) (*sqlstore.Store, error) {
+	cfg := appConfig(c)
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	st, err := newStore(cfg.Database)
+	if err != nil {
+		return nil, fmt.Errorf("newStore failed: %v", err)
+	}
+	sqlSt, ok := st.(*sqlstore.Store)
+	if !ok {
+		st.Close()
+		return nil, fmt.Errorf("database type %s does not support migration", cfg.Database.Type)
+	}
+	return sqlSt, nil
+}
+
+func migrateUpAction(c *cli.Context) error {
+	st, err := newSQLStore(c)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	count, err := st.MigrateUp()
+	if err != nil {
+		return err
+	}
+	log.Infof("%d migrations applied", count)
+	return nil
+}
+
+func migrateDownAction(c *cli.Context) error {
+	n, err := strconv.Atoi(c.Args().First())
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid number of migrations %q", c.Args().First())
+	}
+
+	st, err := newSQLStore(c)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	count, err := st.MigrateDown(n)
+	if err != nil {
+		return err
+	}
+	log.Infof("%d migrations reverted", count)
+	return nil
+}
+
+func migrateStatusAction(c *cli.Context) error {
+	st, err := newSQLStore(c)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	statuses, err := st.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d %-40s %s\n", status.Version, status.Name, appliedAt)
+	}
+	return nil
+}
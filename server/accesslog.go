@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AccessLogConfig contains the settings of access logs.
+type AccessLogConfig struct {
+	// Format is one of "json", "logfmt" and "combined" (Apache combined log format).
+	Format string
+	// Output is where the logs are written to. Default is os.Stdout.
+	Output io.Writer
+	// ExcludePaths are paths or route templates which are not logged, e.g. /ping.
+	ExcludePaths []string
+	// SampleRates maps route templates to the fraction of requests logged, e.g. 0.1 logs
+	// 10% requests. Routes not in it are all logged.
+	SampleRates map[string]float64
+}
+
+// newAccessLogger returns a logger which writes access logs in the format of cfg.
+func newAccessLogger(cfg AccessLogConfig) (*log.Logger, error) {
+	logger := log.New()
+	logger.Out = os.Stdout
+	if cfg.Output != nil {
+		logger.Out = cfg.Output
+	}
+	logger.Level = log.InfoLevel
+
+	switch cfg.Format {
+	case "json":
+		logger.Formatter = &log.JSONFormatter{}
+	case "logfmt":
+		logger.Formatter = &log.TextFormatter{DisableColors: true, FullTimestamp: true}
+	case "combined":
+		logger.Formatter = &combinedFormatter{}
+	default:
+		return nil, fmt.Errorf("unknow access log format %s", cfg.Format)
+	}
+	return logger, nil
+}
+
+// accessLog is the default middleware used to log completed requests. It does nothing
+// unless OptAccessLog is set.
+func (s *Server) accessLog() HandlerFunc {
+	return func(c *Context) {
+		if s.accessLogger == nil {
+			c.Next()
+			return
+		}
+
+		path := c.Request.URL.Path
+		route := c.FullPath()
+		if s.accessLogExcludes[path] || (route != "" && s.accessLogExcludes[route]) {
+			c.Next()
+			return
+		}
+		if rate, ok := s.accessLogConfig.SampleRates[route]; ok && rand.Float64() >= rate {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		s.accessLogger.WithFields(log.Fields{
+			"method":      c.Request.Method,
+			"route":       route,
+			"path":        c.Request.URL.RequestURI(),
+			"proto":       c.Request.Proto,
+			"status":      c.Writer.Status(),
+			"bytes":       size,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"client_ip":   c.ClientIP(),
+			"request_id":  RequestID(c),
+			"user_agent":  c.Request.UserAgent(),
+			"referer":     c.Request.Referer(),
+		}).Info("access")
+	}
+}
+
+// combinedFormatter formats access logs in Apache combined log format.
+type combinedFormatter struct{}
+
+// Format implements log.Formatter.
+func (f *combinedFormatter) Format(entry *log.Entry) ([]byte, error) {
+	field := func(key string) string {
+		v := fmt.Sprint(entry.Data[key])
+		if v == "" || v == "<nil>" {
+			return "-"
+		}
+		return v
+	}
+	size := field("bytes")
+	if size == "0" {
+		size = "-"
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s - - [%s] \"%s %s %s\" %s %s %s %s\n",
+		field("client_ip"),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		field("method"), field("path"), field("proto"),
+		field("status"),
+		size,
+		strconv.Quote(field("referer")),
+		strconv.Quote(field("user_agent")),
+	)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	var newServerFunc = func(cfg AccessLogConfig) *Server {
+		s := New("127.0.0.1:0", OptAddPingHandler(), OptAccessLog(cfg))
+		s.addRoutes("/api", nil, []route{
+			{"GET", "/users/:id", func(c *Context) { c.String(http.StatusOK, "user "+c.Param("id")) }},
+			{"GET", "/panic", func(c *Context) { panic("panic") }},
+			{"GET", "/hot", func(c *Context) { c.String(http.StatusOK, "") }},
+		})
+		return s
+	}
+
+	// Test JSON format
+	out := &bytes.Buffer{}
+	s := newServerFunc(AccessLogConfig{Format: "json", Output: out, ExcludePaths: []string{"/ping"}})
+	sendRequestFunc(s.handler, "GET", "/api/users/1?q=1", H{"User-Agent": "tester", "X-Request-ID": "abc"}, nil)
+	log := map[string]interface{}{}
+	err := json.Unmarshal(out.Bytes(), &log)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "GET", log["method"], "should be equal")
+	assert.Equal(t, "/api/users/:id", log["route"], "should be equal")
+	assert.Equal(t, "/api/users/1?q=1", log["path"], "should be equal")
+	assert.Equal(t, float64(200), log["status"], "should be equal")
+	assert.Equal(t, float64(6), log["bytes"], "should be equal")
+	assert.Equal(t, "192.0.2.1", log["client_ip"], "should be equal")
+	assert.Equal(t, "abc", log["request_id"], "should be equal")
+	assert.Equal(t, "tester", log["user_agent"], "should be equal")
+	assert.NotNil(t, log["duration_ms"], "should not be nil")
+
+	// Test panic is logged with status 500
+	out.Reset()
+	sendRequestFunc(s.handler, "GET", "/api/panic", nil, nil)
+	log = map[string]interface{}{}
+	json.Unmarshal(out.Bytes(), &log)
+	assert.Equal(t, float64(500), log["status"], "should be equal")
+
+	// Test excluded paths
+	out.Reset()
+	sendRequestFunc(s.handler, "GET", "/ping", nil, nil)
+	assert.Equal(t, "", out.String(), "should be equal")
+
+	// Test logfmt format
+	out.Reset()
+	s = newServerFunc(AccessLogConfig{Format: "logfmt", Output: out})
+	sendRequestFunc(s.handler, "GET", "/nothing", nil, nil)
+	assert.Contains(t, out.String(), `method=GET`, "should contain")
+	assert.Contains(t, out.String(), `status=404`, "should contain")
+	assert.Contains(t, out.String(), `path=/nothing`, "should contain")
+
+	// Test combined format
+	out.Reset()
+	s = newServerFunc(AccessLogConfig{Format: "combined", Output: out})
+	sendRequestFunc(s.handler, "GET", "/api/users/1", H{"User-Agent": "tester", "Referer": "http://ref.com/"}, nil)
+	sendRequestFunc(s.handler, "GET", "/api/hot", nil, nil)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines), "should be equal")
+	assert.Regexp(t, regexp.MustCompile(`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /api/users/1 HTTP/1\.1" 200 6 "http://ref\.com/" "tester"$`), lines[0], "should match")
+	assert.Regexp(t, regexp.MustCompile(`"GET /api/hot HTTP/1\.1" 200 - "-" "-"$`), lines[1], "should match")
+
+	// Test sampling
+	out.Reset()
+	s = newServerFunc(AccessLogConfig{Format: "logfmt", Output: out, SampleRates: map[string]float64{"/api/hot": 0}})
+	for i := 0; i < 10; i++ {
+		sendRequestFunc(s.handler, "GET", "/api/hot", nil, nil)
+	}
+	assert.Equal(t, "", out.String(), "should be equal")
+	sendRequestFunc(s.handler, "GET", "/api/users/1", nil, nil)
+	assert.Contains(t, out.String(), `route="/api/users/:id"`, "should contain")
+
+	// Test unknown format
+	s = New("127.0.0.1:0", OptAccessLog(AccessLogConfig{Format: "xml"}))
+	assert.Nil(t, s.accessLogger, "should be nil")
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setAdminRoutes adds the admin routes enabled by the options, e.g. OptAddDebugHandler,
+// into the router of OptAdminAddress or the default router. They are guarded by
+// adminAuth, and /admin/reload requires credentials as well.
+func (s *Server) setAdminRoutes() {
+	router := s.routerEngine
+	if s.adminAddress != "" {
+		s.adminEngine = gin.New()
+		s.adminEngine.NoRoute(func(c *Context) {
+			s.notFoundResp(c, fmt.Errorf("request not found [%s] %s", c.Request.Method, c.Request.URL), "")
+		})
+		s.adminEngine.Use(s.requestID(), s.errorFormat(), s.localize(), s.recover(), s.renderError())
+		router = s.adminEngine
+	}
+
+	group := router.Group("/", s.adminAuth())
+	if s.hasDebugHandler {
+		s.addDebugRoutes(group)
+	}
+	if s.reload != nil {
+		group.POST("/admin/reload", s.requireAdminCredentials(), s.reloadHandler(s.reload))
+	}
+}
+
+// addDebugRoutes adds the routes of OptAddDebugHandler into group.
+func (s *Server) addDebugRoutes(group *gin.RouterGroup) {
+	httpToGin := func(h http.HandlerFunc) HandlerFunc {
+		handler := h
+		return func(c *Context) {
+			handler.ServeHTTP(c.Writer, c.Request)
+		}
+	}
+	pprofIndex := func(c *Context) {
+		pprof.Handler(strings.TrimPrefix(c.Request.URL.Path, "/debug/")).ServeHTTP(c.Writer, c.Request)
+	}
+	group.GET("/debug/pprof", httpToGin(pprof.Index))
+	group.GET("/debug/pprof/cmdline", httpToGin(pprof.Cmdline))
+	group.GET("/debug/pprof/profile", httpToGin(pprof.Profile))
+	group.GET("/debug/pprof/symbol", httpToGin(pprof.Symbol))
+	group.POST("/debug/pprof/symbol", httpToGin(pprof.Symbol))
+	group.GET("/debug/pprof/trace", httpToGin(pprof.Trace))
+	group.GET("/debug/block", pprofIndex)
+	group.GET("/debug/goroutine", pprofIndex)
+	group.GET("/debug/heap", pprofIndex)
+	group.GET("/debug/mutex", pprofIndex)
+	group.GET("/debug/threadcreate", pprofIndex)
+	group.GET("/debug/tls", s.debugTLSHandler)
+	group.GET("/debug/loglevel", s.getLogLevelHandler)
+	group.PUT("/debug/loglevel", s.putLogLevelHandler)
+}
+
+// adminAuth is the middleware of admin routes. A request must come from an address of
+// OptAdminAllowIPs if it is set, and carry the token of OptAdminToken or the credentials
+// of OptAdminBasicAuth if either is set. Admin routes are forbidden if none of them is
+// set, unless they are served on a loopback address of OptAdminAddress.
+func (s *Server) adminAuth() HandlerFunc {
+	return func(c *Context) {
+		if s.adminAllowNets != nil && !s.adminAllowed(c.Request.RemoteAddr) {
+			s.forbiddenResp(c, fmt.Errorf("admin request from %s is not allowed", c.Request.RemoteAddr), "")
+			c.Abort()
+			return
+		}
+
+		if s.adminToken == "" && s.adminUsername == "" {
+			if s.adminAllowNets == nil && !isLoopbackAddress(s.adminAddress) {
+				s.forbiddenResp(c, errors.New("admin routes are not guarded"), "")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !s.adminAuthenticated(c) {
+			if s.adminUsername != "" {
+				c.Header("WWW-Authenticate", `Basic realm="admin"`)
+			}
+			s.authenticationErrorResp(c, errors.New("admin credentials are missing or wrong"), "")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireAdminCredentials forbids the admin route if neither OptAdminToken nor
+// OptAdminBasicAuth is set, since a loopback listener or an allowlist does not tell who
+// sends the request. The credentials are checked by adminAuth.
+func (s *Server) requireAdminCredentials() HandlerFunc {
+	return func(c *Context) {
+		if s.adminToken == "" && s.adminUsername == "" {
+			s.forbiddenResp(c, fmt.Errorf("admin route %s requires credentials", c.Request.URL.Path), "")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// isLoopbackAddress reports whether address like 127.0.0.1:6060 binds only a loopback
+// interface. An address without host, e.g. :6060, binds all interfaces.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// adminAllowed reports whether remoteAddr is in the networks of OptAdminAllowIPs. The
+// address of the connection is used instead of c.ClientIP, since X-Forwarded-For can be
+// forged.
+func (s *Server) adminAllowed(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.adminAllowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// adminAuthenticated reports whether the request carries the token of OptAdminToken as
+// a bearer token, or the credentials of OptAdminBasicAuth.
+func (s *Server) adminAuthenticated(c *Context) bool {
+	authorization := c.GetHeader("Authorization")
+
+	const prefix = "Bearer "
+	if s.adminToken != "" && len(authorization) > len(prefix) && strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return subtle.ConstantTimeCompare([]byte(authorization[len(prefix):]), []byte(s.adminToken)) == 1
+	}
+
+	if username, password, ok := c.Request.BasicAuth(); ok && s.adminUsername != "" {
+		usernameOK := subtle.ConstantTimeCompare([]byte(username), []byte(s.adminUsername)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.adminPassword)) == 1
+		return usernameOK && passwordOK
+	}
+	return false
+}
+
+// parseAllowNet parses an IP or a CIDR like 10.0.0.0/8. An IP is the network of itself.
+func parseAllowNet(cidr string) (*net.IPNet, error) {
+	if strings.Contains(cidr, "/") {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s", cidr)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(cidr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %s", cidr)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// runAdmin starts the listener of OptAdminAddress, which serves admin routes without
+// encryption. The caller must hold s.mu.
+func (s *Server) runAdmin() error {
+	if s.adminAddress == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.adminAddress)
+	if err != nil {
+		return fmt.Errorf("listen on %s failed: %v", s.adminAddress, err)
+	}
+
+	s.adminServer = &http.Server{
+		Handler:           s.adminEngine,
+		ReadHeaderTimeout: s.readTimeout,
+		IdleTimeout:       s.idleTimeout,
+	}
+	s.adminListener = ln
+	go func(srv *http.Server) {
+		logger.Infof("listen on %s for admin routes", ln.Addr())
+		err := srv.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorf("serve admin routes error %s", err)
+		}
+	}(s.adminServer)
+	return nil
+}
+
+// stopAdmin closes the listener of OptAdminAddress. The caller must hold s.mu.
+func (s *Server) stopAdmin() {
+	if s.adminServer != nil {
+		s.adminServer.Close()
+		s.adminServer = nil
+	}
+}
+
+// AdminAddr returns the address the admin listener of OptAdminAddress is listening on.
+// It returns nil if the listener has never run.
+func (s *Server) AdminAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.adminListener == nil {
+		return nil
+	}
+	return s.adminListener.Addr()
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	// Test admin routes are forbidden without any guard
+	s := New("0.0.0.0:8888", OptAddDebugHandler())
+	status, _, respBody := sendRequestFunc(s.handler, "GET", "/debug/pprof", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusForbidden, status, "should be equal")
+	assert.Equal(t, `{"error":{"code":"Forbidden","msg":"Forbidden","request_id":"abc"}}`, respBody, "should be equal")
+
+	unauthorized := `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`
+	type testCase struct {
+		Opts             []Option
+		Headers          H
+		ExpectedStatus   int
+		ExpectedRespBody string
+	}
+	testCases := []testCase{
+		// Token
+		{[]Option{OptAdminToken("secret")}, H{"Authorization": "Bearer secret"}, http.StatusOK, ""},
+		{[]Option{OptAdminToken("secret")}, H{"Authorization": "bearer secret"}, http.StatusOK, ""},
+		{[]Option{OptAdminToken("secret")}, H{"X-Request-ID": "abc"}, http.StatusUnauthorized, unauthorized},
+		{[]Option{OptAdminToken("secret")}, H{"Authorization": "Bearer secrets", "X-Request-ID": "abc"}, http.StatusUnauthorized, unauthorized},
+		{[]Option{OptAdminToken("secret")}, H{"Authorization": "Basic secret", "X-Request-ID": "abc"}, http.StatusUnauthorized, unauthorized},
+		// Basic auth, YWRtaW46cGFzcw== is admin:pass
+		{[]Option{OptAdminBasicAuth("admin", "pass")}, H{"Authorization": "Basic YWRtaW46cGFzcw=="}, http.StatusOK, ""},
+		{[]Option{OptAdminBasicAuth("admin", "pass")}, H{"Authorization": "Basic YWRtaW46cGFzczE=", "X-Request-ID": "abc"}, http.StatusUnauthorized, unauthorized},
+		{[]Option{OptAdminBasicAuth("admin", "pass"), OptAdminToken("secret")}, H{"Authorization": "Bearer secret"}, http.StatusOK, ""},
+		// IP allowlist, the address of httptest requests is 192.0.2.1
+		{[]Option{OptAdminAllowIPs("10.0.0.0/8", "192.0.2.0/24")}, nil, http.StatusOK, ""},
+		{[]Option{OptAdminAllowIPs("192.0.2.1")}, nil, http.StatusOK, ""},
+		{[]Option{OptAdminAllowIPs("10.0.0.0/8")}, H{"X-Forwarded-For": "10.0.0.1"}, http.StatusForbidden, ""},
+		{[]Option{OptAdminAllowIPs("x", "192.0.2.0/33")}, nil, http.StatusForbidden, ""},
+		{[]Option{OptAdminAllowIPs("192.0.2.1"), OptAdminToken("secret")}, H{"X-Request-ID": "abc"}, http.StatusUnauthorized, unauthorized},
+		{[]Option{OptAdminAllowIPs("10.0.0.1"), OptAdminToken("secret")}, H{"Authorization": "Bearer secret"}, http.StatusForbidden, ""},
+	}
+	for i, c := range testCases {
+		s := New("0.0.0.0:8888", append(c.Opts, OptAddDebugHandler())...)
+		status, header, respBody := sendRequestFunc(s.handler, "GET", "/debug/pprof/cmdline", c.Headers, nil)
+		assert.Equal(t, c.ExpectedStatus, status, "case %d", i)
+		if c.ExpectedRespBody != "" {
+			assert.Equal(t, c.ExpectedRespBody, respBody, "case %d", i)
+		}
+		if status == http.StatusUnauthorized && s.adminUsername != "" {
+			assert.Equal(t, `Basic realm="admin"`, header.Get("WWW-Authenticate"), "should be equal")
+		}
+	}
+
+	// Test admin listeners are open without guards only on loopback addresses
+	for address, expectedStatus := range map[string]int{
+		"127.0.0.1:6060": http.StatusOK,
+		"[::1]:6060":     http.StatusOK,
+		"localhost:6060": http.StatusOK,
+		"0.0.0.0:6060":   http.StatusForbidden,
+		":6060":          http.StatusForbidden,
+		"10.0.0.1:6060":  http.StatusForbidden,
+	} {
+		s := New("0.0.0.0:8888", OptAdminAddress(address), OptAddDebugHandler())
+		status, _, _ := sendRequestFunc(s.adminEngine, "GET", "/debug/pprof/cmdline", nil, nil)
+		assert.Equal(t, expectedStatus, status, address)
+	}
+
+	// Test the reload route requires credentials even if other guards are set
+	reload := func() error { return nil }
+	for _, opts := range [][]Option{
+		{OptAdminAddress("127.0.0.1:6060")},
+		{OptAdminAllowIPs("192.0.2.1")},
+	} {
+		s := New("0.0.0.0:8888", append(opts, OptAddReloadHandler(reload))...)
+		handler := http.Handler(s.handler)
+		if s.adminEngine != nil {
+			handler = s.adminEngine
+		}
+		status, _, _ := sendRequestFunc(handler, "POST", "/admin/reload", nil, nil)
+		assert.Equal(t, http.StatusForbidden, status, "should be equal")
+	}
+	s = New("0.0.0.0:8888", OptAdminAllowIPs("192.0.2.1"), OptAdminBasicAuth("admin", "pass"), OptAddReloadHandler(reload))
+	status, _, _ = sendRequestFunc(s.handler, "POST", "/admin/reload", H{"Authorization": "Basic YWRtaW46cGFzcw=="}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+}
+
+func TestAdminAddress(t *testing.T) {
+	s := New("127.0.0.1:0", OptAdminAddress("127.0.0.1:0"), OptAddDebugHandler(), OptAddPingHandler())
+	err := s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	adminURL := "http://" + s.AdminAddr().String()
+	url := "http://" + s.Addr().String()
+
+	// Test admin routes are served only on the admin listener
+	resp, err := http.Get(adminURL + "/debug/pprof/cmdline")
+	if assert.Nil(t, err, "should be nil") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should be equal")
+	}
+	resp, err = http.Get(adminURL + "/ping")
+	if assert.Nil(t, err, "should be nil") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should be equal")
+	}
+	resp, err = http.Get(url + "/debug/pprof/cmdline")
+	if assert.Nil(t, err, "should be nil") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should be equal")
+	}
+
+	// Test admin listener is stopped with the server
+	_, err = s.Stop()
+	assert.Nil(t, err, "should be nil")
+	_, err = http.Get(adminURL + "/debug/pprof/cmdline")
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test admin listener with guards
+	s = New("127.0.0.1:0", OptAdminAddress("127.0.0.1:0"), OptAdminToken("secret"), OptAddDebugHandler())
+	err = s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	defer s.Stop()
+	resp, err = http.Get("http://" + s.AdminAddr().String() + "/debug/pprof/cmdline")
+	if assert.Nil(t, err, "should be nil") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "should be equal")
+	}
+
+	// Test server does not run if the admin address can not be bound
+	s2 := New("127.0.0.1:0", OptAdminAddress(s.AdminAddr().String()))
+	err = s2.Run()
+	assert.NotNil(t, err, "should not be nil")
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+)
+
+// APIError is an error which knows how it is responded. Handlers can add it by c.Error
+// and return, then the renderError middleware responds it as a error JSON.
+type APIError struct {
+	// Status is the HTTP status code.
+	Status int
+	// Code is the code in the error JSON, e.g. NotFound.
+	Code string
+	// Message is the msg in the error JSON. Default is the message of Code localized for
+	// the request, or the text of Status.
+	Message string
+	// Details is responded with the error if it is not nil.
+	Details interface{}
+	// Cause is the underlying error which is logged but not responded.
+	Cause error
+}
+
+// NewAPIError returns a new APIError.
+func NewAPIError(status int, code, msg string) *APIError {
+	return &APIError{Status: status, Code: code, Message: msg}
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.message(), e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.message())
+}
+
+// Unwrap returns the cause, so errors.Is and errors.As can look into it.
+func (e *APIError) Unwrap() error {
+	return e.Cause
+}
+
+// WithDetails returns a copy of the error with the details.
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	err := *e
+	err.Details = details
+	return &err
+}
+
+// WithCause returns a copy of the error with the cause.
+func (e *APIError) WithCause(cause error) *APIError {
+	err := *e
+	err.Cause = cause
+	return &err
+}
+
+func (e *APIError) message() string {
+	if e.Message == "" {
+		return http.StatusText(e.Status)
+	}
+	return e.Message
+}
+
+// ToAPIError maps err to an APIError. An APIError in the chain of err is returned as
+// is, or with InternalServerError (500) if its Status is zero, errors of store are mapped to NotFound (404), Conflict (409) and
+// ServiceUnavailable (503), and others are mapped to InternalServerError (500).
+func ToAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Status == 0 {
+			e := *apiErr
+			e.Status = http.StatusInternalServerError
+			return &e
+		}
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		apiErr = NewAPIError(http.StatusNotFound, "NotFound", "")
+	case errors.Is(err, store.ErrDuplicate):
+		apiErr = NewAPIError(http.StatusConflict, "Conflict", "")
+	case errors.Is(err, store.ErrConnectionFailed):
+		apiErr = NewAPIError(http.StatusServiceUnavailable, "ServiceUnavailable", "")
+	default:
+		apiErr = NewAPIError(http.StatusInternalServerError, "InternalServerError", "")
+	}
+	return apiErr.WithCause(err)
+}
+
+// renderError is the default middleware which responds the last error added by c.Error,
+// unless the handler has already responded.
+func (s *Server) renderError() HandlerFunc {
+	return func(c *Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		s.apiErrorResp(c, c.Errors.Last().Err)
+	}
+}
+
+// apiErrorResp logs err and responds it as a error JSON. Server errors are logged at
+// Error level and others at Debug level like the other resp helpers. Store errors are
+// counted if OptMetrics is set.
+func (s *Server) apiErrorResp(c *Context, err error) {
+	apiErr := ToAPIError(err)
+	if isStoreError(err) {
+		s.observeStoreError(err)
+	}
+
+	entry := logger.WithField("request_id", RequestID(c))
+	if apiErr.Status >= http.StatusInternalServerError {
+		entry.Errorf("APIError: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	} else {
+		entry.Debugf("APIError: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	}
+	errRespWithDetails(c, apiErr.Status, apiErr.Code, apiErr.Message, apiErr.Details)
+}
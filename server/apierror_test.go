@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIError(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	// Test error message
+	err := NewAPIError(http.StatusBadRequest, "InvalidParameter", "")
+	assert.Equal(t, "InvalidParameter: Bad Request", err.Error(), "should be equal")
+	cause := errors.New("bad id")
+	assert.Equal(t, "InvalidParameter: Bad Request: bad id", err.WithCause(cause).Error(), "should be equal")
+	assert.Equal(t, true, errors.Is(err.WithCause(cause), cause), "should be true")
+	assert.Nil(t, err.Cause, "should be nil")
+
+	// Test mapping
+	type testCase struct {
+		Path               string
+		Err                error
+		ExpectedStatusCode int
+		ExpectedBodyString string
+	}
+	testCases := []testCase{
+		{"/apierror", NewAPIError(http.StatusBadRequest, "InvalidParameter", "Invalid Parameter"), http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","request_id":"abc"}}`},
+		{"/details", NewAPIError(http.StatusBadRequest, "InvalidParameter", "").WithDetails(H{"name": "required"}), http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","details":{"name":"required"},"request_id":"abc"}}`},
+		{"/wrapped", fmt.Errorf("get user: %w", NewAPIError(http.StatusForbidden, "Forbidden", "")), http.StatusForbidden, `{"error":{"code":"Forbidden","msg":"Forbidden","request_id":"abc"}}`},
+		{"/notfound", store.ErrNotFound, http.StatusNotFound, `{"error":{"code":"NotFound","msg":"Not Found","request_id":"abc"}}`},
+		{"/duplicate", fmt.Errorf("create user: %w", store.ErrDuplicate), http.StatusConflict, `{"error":{"code":"Conflict","msg":"Conflict","request_id":"abc"}}`},
+		{"/connectionfailed", store.ErrConnectionFailed, http.StatusServiceUnavailable, `{"error":{"code":"ServiceUnavailable","msg":"Service Unavailable","request_id":"abc"}}`},
+		{"/zerostatus", &APIError{Code: "Oops"}, http.StatusInternalServerError, `{"error":{"code":"Oops","msg":"Internal Server Error","request_id":"abc"}}`},
+		{"/other", errors.New("oops"), http.StatusInternalServerError, `{"error":{"code":"InternalServerError","msg":"Internal Server Error","request_id":"abc"}}`},
+	}
+	s := New("0.0.0.0:8888")
+	routes := []route{}
+	for i := range testCases {
+		err := testCases[i].Err
+		routes = append(routes, route{"GET", testCases[i].Path, func(c *Context) { c.Error(err) }})
+	}
+	s.addRoutes("/api", nil, routes)
+	for _, c := range testCases {
+		status, respBody := sendRequestFunc(s.handler, "GET", "/api"+c.Path, H{"X-Request-ID": "abc"}, nil)
+		assert.Equal(t, c.ExpectedStatusCode, status, "should be equal")
+		assert.Equal(t, c.ExpectedBodyString, respBody, "should be equal")
+	}
+
+	// Test the last error is responded
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/last", func(c *Context) {
+			c.Error(store.ErrNotFound)
+			c.Error(store.ErrDuplicate)
+		}},
+	})
+	status, _ := sendRequestFunc(s.handler, "GET", "/api/last", nil, nil)
+	assert.Equal(t, http.StatusConflict, status, "should be equal")
+
+	// Test error is not responded if handler has responded
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/responded", func(c *Context) {
+			c.Error(store.ErrNotFound)
+			c.String(http.StatusAccepted, "accepted")
+		}},
+	})
+	status, respBody := sendRequestFunc(s.handler, "GET", "/api/responded", nil, nil)
+	assert.Equal(t, http.StatusAccepted, status, "should be equal")
+	assert.Equal(t, "accepted", respBody, "should be equal")
+
+	// Test error added in group with timeout
+	s.addRoutes("/timeout", []HandlerFunc{s.timeout(time.Second)}, []route{
+		{"GET", "/notfound", func(c *Context) { c.Error(store.ErrNotFound) }},
+	})
+	status, _ = sendRequestFunc(s.handler, "GET", "/timeout/notfound", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig contains the CORS policy of requests.
+type CORSConfig struct {
+	// AllowOrigins are the allowed origins. An origin is exact like https://example.com,
+	// wildcard subdomain like https://*.example.com, or * to allow any origin.
+	AllowOrigins []string
+	// AllowOriginRegexps are the regular expressions of allowed origins, e.g.
+	// https://pr-\d+\.example\.com. They must match the whole origin.
+	AllowOriginRegexps []string
+	// AllowMethods are the methods allowed by preflight. Default is GET, POST, PUT,
+	// PATCH, DELETE and HEAD.
+	AllowMethods []string
+	// AllowHeaders are the headers allowed by preflight. Default is the headers requested
+	// by preflight.
+	AllowHeaders []string
+	// ExposeHeaders are the response headers readable by the client, e.g. X-Request-ID.
+	ExposeHeaders []string
+	// AllowCredentials allows requests with cookies or authorization. The allowed origin
+	// is responded instead of * if it is true. It cannot be used with the origin *, which
+	// would allow credentialed requests from any site.
+	AllowCredentials bool
+	// MaxAge is how long the result of preflight can be cached. Zero omits the header.
+	MaxAge time.Duration
+}
+
+// defaultCORSMethods are the methods allowed if CORSConfig.AllowMethods is empty.
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+// corsPolicy is the compiled CORSConfig.
+type corsPolicy struct {
+	allowAll         bool
+	origins          map[string]bool
+	wildcards        [][2]string
+	regexps          []*regexp.Regexp
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// prefixCORSPolicy is the policy which overrides the default one for a path prefix.
+type prefixCORSPolicy struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// newCORSPolicy compiles cfg. It returns error if an origin or regexp is invalid, or if
+// credentials are allowed for any origin.
+func newCORSPolicy(cfg CORSConfig) (*corsPolicy, error) {
+	p := &corsPolicy{
+		origins:          make(map[string]bool),
+		allowHeaders:     strings.Join(cfg.AllowHeaders, ", "),
+		exposeHeaders:    strings.Join(cfg.ExposeHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+	}
+	for _, origin := range cfg.AllowOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			p.allowAll = true
+		case strings.Count(origin, "*") > 1:
+			return nil, fmt.Errorf("origin %s has more than one wildcard", origin)
+		case strings.Contains(origin, "://*."):
+			i := strings.Index(origin, "*")
+			p.wildcards = append(p.wildcards, [2]string{origin[:i], origin[i+1:]})
+		case strings.Contains(origin, "*"):
+			return nil, fmt.Errorf("origin %s is not a wildcard subdomain", origin)
+		default:
+			p.origins[origin] = true
+		}
+	}
+	for _, expr := range cfg.AllowOriginRegexps {
+		// Anchor the expression, so https://a\.com does not allow https://a.com.evil.net
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("origin regexp %s is invalid: %v", expr, err)
+		}
+		p.regexps = append(p.regexps, re)
+	}
+	if p.allowAll && p.allowCredentials {
+		return nil, fmt.Errorf("origin * cannot be allowed with credentials")
+	}
+
+	methods := cfg.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	p.allowMethods = strings.ToUpper(strings.Join(methods, ", "))
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+	return p, nil
+}
+
+// allowOrigin reports whether origin is allowed.
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		// The wildcard matches at least one label, e.g. https://a.example.com
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	for _, re := range p.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsPolicyFor returns the policy of the longest prefix matching path, or the default
+// policy of OptCORS or Reload.
+func (s *Server) corsPolicyFor(path string) *corsPolicy {
+	for _, pp := range s.corsPrefixPolicies {
+		if path == pp.prefix || strings.HasPrefix(path, strings.TrimSuffix(pp.prefix, "/")+"/") {
+			return pp.policy
+		}
+	}
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	return s.corsPolicy
+}
+
+// addCORSPrefixPolicy adds the policy of prefix, keeping longer prefixes first.
+func (s *Server) addCORSPrefixPolicy(prefix string, policy *corsPolicy) {
+	s.corsPrefixPolicies = append(s.corsPrefixPolicies, prefixCORSPolicy{prefix: prefix, policy: policy})
+	sort.SliceStable(s.corsPrefixPolicies, func(i, j int) bool {
+		return len(s.corsPrefixPolicies[i].prefix) > len(s.corsPrefixPolicies[j].prefix)
+	})
+}
+
+// cors is the default middleware which adds CORS headers to cross-origin requests and
+// responds preflight requests, so they do not need OPTIONS routes. It does nothing unless
+// OptCORS or OptCORSPrefix is set.
+func (s *Server) cors() HandlerFunc {
+	return func(c *Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		policy := s.corsPolicyFor(c.Request.URL.Path)
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if !policy.allowOrigin(origin) {
+			if preflight {
+				s.forbiddenResp(c, fmt.Errorf("origin %s is not allowed", origin), "")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if policy.allowAll && !policy.allowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.allowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if policy.exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", policy.allowMethods)
+		if policy.allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", policy.allowHeaders)
+		} else if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if policy.maxAge != "" {
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
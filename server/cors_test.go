@@ -0,0 +1,128 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	s := New("0.0.0.0:8888",
+		OptCORS(CORSConfig{
+			AllowOrigins:       []string{"https://app.example.com", "https://*.example.org"},
+			AllowOriginRegexps: []string{`^https://pr-\d+\.preview\.dev$`, `https://app\.example\.com`},
+			AllowHeaders:       []string{"Authorization", "Content-Type"},
+			ExposeHeaders:      []string{"X-Request-ID"},
+			AllowCredentials:   true,
+			MaxAge:             10 * time.Minute,
+		}),
+		OptCORSPrefix("/public", CORSConfig{AllowOrigins: []string{"*"}, AllowMethods: []string{"get"}}),
+		OptCORSPrefix("/public/private", CORSConfig{AllowOrigins: []string{"https://admin.example.com"}}),
+	)
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/items", func(c *Context) { c.String(http.StatusOK, "items") }},
+	})
+	s.addRoutes("/public", nil, []route{
+		{"GET", "/items", func(c *Context) { c.String(http.StatusOK, "public items") }},
+	})
+
+	// Test origins of actual requests
+	type testCase struct {
+		Path          string
+		Origin        string
+		ExpectedAllow string
+	}
+	testCases := []testCase{
+		{"/api/items", "https://app.example.com", "https://app.example.com"},
+		{"/api/items", "https://APP.example.com", "https://APP.example.com"},
+		{"/api/items", "https://a.example.org", "https://a.example.org"},
+		{"/api/items", "https://a.b.example.org", "https://a.b.example.org"},
+		{"/api/items", "https://example.org", ""},
+		{"/api/items", "https://evil-example.org", ""},
+		{"/api/items", "http://app.example.com", ""},
+		{"/api/items", "https://pr-12.preview.dev", "https://pr-12.preview.dev"},
+		{"/api/items", "https://pr-x.preview.dev", ""},
+		{"/api/items", "https://pr-12.preview.dev.evil.net", ""},
+		{"/api/items", "https://app.example.com.evil.net", ""},
+		{"/public/items", "https://any.com", "*"},
+		{"/publicity", "https://any.com", ""},
+	}
+	for _, c := range testCases {
+		status, header, _ := sendRequestFunc(s.handler, "GET", c.Path, H{"Origin": c.Origin}, nil)
+		assert.NotEqual(t, http.StatusForbidden, status, "should not be equal")
+		assert.Equal(t, c.ExpectedAllow, header.Get("Access-Control-Allow-Origin"), c.Origin)
+		assert.Equal(t, "Origin", header.Get("Vary"), "should be equal")
+	}
+
+	status, header, respBody := sendRequestFunc(s.handler, "GET", "/api/items", H{"Origin": "https://app.example.com"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "items", respBody, "should be equal")
+	assert.Equal(t, "true", header.Get("Access-Control-Allow-Credentials"), "should be equal")
+	assert.Equal(t, "X-Request-ID", header.Get("Access-Control-Expose-Headers"), "should be equal")
+	assert.Equal(t, "", header.Get("Access-Control-Allow-Methods"), "should be equal")
+
+	// Test no CORS headers without Origin
+	_, header, _ = sendRequestFunc(s.handler, "GET", "/api/items", nil, nil)
+	assert.Equal(t, "", header.Get("Access-Control-Allow-Origin"), "should be equal")
+
+	// Test preflight
+	preflight := H{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "X-Custom"}
+	status, header, respBody = sendRequestFunc(s.handler, "OPTIONS", "/api/items", preflight, nil)
+	assert.Equal(t, http.StatusNoContent, status, "should be equal")
+	assert.Equal(t, "", respBody, "should be equal")
+	assert.Equal(t, "https://app.example.com", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "GET, POST, PUT, PATCH, DELETE, HEAD", header.Get("Access-Control-Allow-Methods"), "should be equal")
+	assert.Equal(t, "Authorization, Content-Type", header.Get("Access-Control-Allow-Headers"), "should be equal")
+	assert.Equal(t, "600", header.Get("Access-Control-Max-Age"), "should be equal")
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, header.Values("Vary"), "should be equal")
+
+	// Test preflight of unknown path does not fall through to NoRoute
+	status, _, _ = sendRequestFunc(s.handler, "OPTIONS", "/api/nothing", preflight, nil)
+	assert.Equal(t, http.StatusNoContent, status, "should be equal")
+
+	// Test preflight with prefix policy
+	preflight["Origin"] = "https://any.com"
+	status, header, _ = sendRequestFunc(s.handler, "OPTIONS", "/public/items", preflight, nil)
+	assert.Equal(t, http.StatusNoContent, status, "should be equal")
+	assert.Equal(t, "*", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "GET", header.Get("Access-Control-Allow-Methods"), "should be equal")
+	assert.Equal(t, "X-Custom", header.Get("Access-Control-Allow-Headers"), "should be equal")
+	assert.Equal(t, "", header.Get("Access-Control-Max-Age"), "should be equal")
+
+	// Test preflight of disallowed origin
+	status, header, _ = sendRequestFunc(s.handler, "OPTIONS", "/public/private/items", preflight, nil)
+	assert.Equal(t, http.StatusForbidden, status, "should be equal")
+	assert.Equal(t, "", header.Get("Access-Control-Allow-Origin"), "should be equal")
+
+	// Test OPTIONS without preflight headers
+	status, _, _ = sendRequestFunc(s.handler, "OPTIONS", "/api/items", H{"Origin": "https://app.example.com"}, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+
+	// Test invalid config
+	s = New("0.0.0.0:8888", OptCORS(CORSConfig{AllowOrigins: []string{"https://*.*.com"}}))
+	assert.Nil(t, s.corsPolicy, "should be nil")
+	s = New("0.0.0.0:8888", OptCORS(CORSConfig{AllowOrigins: []string{"https://app*.com"}}))
+	assert.Nil(t, s.corsPolicy, "should be nil")
+	s = New("0.0.0.0:8888", OptCORS(CORSConfig{AllowOriginRegexps: []string{"("}}))
+	assert.Nil(t, s.corsPolicy, "should be nil")
+	_, err := newCORSPolicy(CORSConfig{AllowOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true})
+	assert.NotNil(t, err, "should not be nil")
+	s = New("0.0.0.0:8888", OptCORSPrefix("/public", CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}))
+	assert.Equal(t, 0, len(s.corsPrefixPolicies), "should be equal")
+}
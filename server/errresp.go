@@ -2,71 +2,109 @@ package server
 
 import "net/http"
 
+// defaultMessages are the messages of codes used when msg is empty and OptMessageCatalog
+// has no message of the code for the request.
+var defaultMessages = map[string]string{
+	"InvalidParameter":      "Invalid Parameter",
+	"AuthenticationError":   "Authentication Error",
+	"AuthenticationExpired": "Authentication Expired",
+	"Forbidden":             http.StatusText(http.StatusForbidden),
+	"NotFound":              http.StatusText(http.StatusNotFound),
+	"Conflict":              http.StatusText(http.StatusConflict),
+	"TooManyRequests":       http.StatusText(http.StatusTooManyRequests),
+	"InternalServerError":   http.StatusText(http.StatusInternalServerError),
+	"ServiceUnavailable":    http.StatusText(http.StatusServiceUnavailable),
+	"TimeoutError":          http.StatusText(http.StatusGatewayTimeout),
+}
+
+// defaultMessage returns the message of code localized for the request, or the default
+// one, or the text of status.
+func defaultMessage(c *Context, status int, code string) string {
+	if msg, ok := lookupMessage(c, code, nil); ok {
+		return msg
+	}
+	if msg, ok := defaultMessages[code]; ok {
+		return msg
+	}
+	return http.StatusText(status)
+}
+
 // errResp responds a error JSON.
 func errResp(c *Context, status int, code, msg string) {
+	errRespWithDetails(c, status, code, msg, nil)
+}
+
+// errRespWithDetails responds a error JSON with details about the error.
+func errRespWithDetails(c *Context, status int, code, msg string, details interface{}) {
+	if msg == "" {
+		msg = defaultMessage(c, status, code)
+	}
+	if respondsProblem(c) {
+		problemResp(c, status, code, msg, details)
+		return
+	}
+
 	ers := &struct {
 		Error struct {
-			Code    string `json:"code"`
-			Message string `json:"msg"`
+			Code      string      `json:"code"`
+			Message   string      `json:"msg"`
+			Details   interface{} `json:"details,omitempty"`
+			RequestID string      `json:"request_id,omitempty"`
 		} `json:"error"`
 	}{}
 	ers.Error.Code = code
 	ers.Error.Message = msg
+	ers.Error.Details = details
+	ers.Error.RequestID = RequestID(c)
 	c.JSON(status, ers)
 }
 
 // InvalidParameterResp responds a error JSON because of the invalid parameter.
 func InvalidParameterResp(c *Context, msg string) {
-	if msg == "" {
-		msg = "Invalid Parameter"
-	}
 	errResp(c, http.StatusBadRequest, "InvalidParameter", msg)
 }
 
 // AuthenticationErrorResp responds a error JSON because of the authentication failed.
 func AuthenticationErrorResp(c *Context, msg string) {
-	if msg == "" {
-		msg = "Authentication Error"
-	}
 	errResp(c, http.StatusUnauthorized, "AuthenticationError", msg)
 }
 
 // AuthenticationExpiredResp responds a error JSON because of the authentication expired.
 func AuthenticationExpiredResp(c *Context, msg string) {
-	if msg == "" {
-		msg = "Authentication Expired"
-	}
 	errResp(c, http.StatusUnauthorized, "AuthenticationExpired", msg)
 }
 
 // ForbiddenResp responds a error JSON because of the unauthorized operation.
 func ForbiddenResp(c *Context, msg string) {
-	if msg == "" {
-		msg = http.StatusText(http.StatusForbidden)
-	}
 	errResp(c, http.StatusForbidden, "Forbidden", msg)
 }
 
 // NotFoundResp responds a error JSON because resource is not found.
 func NotFoundResp(c *Context, msg string) {
-	if msg == "" {
-		msg = http.StatusText(http.StatusNotFound)
-	}
 	errResp(c, http.StatusNotFound, "NotFound", msg)
 }
 
+// ConflictResp responds a error JSON because the operation conflicts with existing data.
+func ConflictResp(c *Context, msg string) {
+	errResp(c, http.StatusConflict, "Conflict", msg)
+}
+
+// TooManyRequestsResp responds a error JSON because the rate limit is exceeded.
+func TooManyRequestsResp(c *Context, msg string) {
+	errResp(c, http.StatusTooManyRequests, "TooManyRequests", msg)
+}
+
 // InternalServerErrorResp responds a error JSON because of an unexpected error.
 func InternalServerErrorResp(c *Context, msg string) {
-	if msg == "" {
-		msg = http.StatusText(http.StatusInternalServerError)
-	}
 	errResp(c, http.StatusInternalServerError, "InternalServerError", msg)
 }
 
+// ServiceUnavailableResp responds a error JSON because a dependency is unavailable.
+func ServiceUnavailableResp(c *Context, msg string) {
+	errResp(c, http.StatusServiceUnavailable, "ServiceUnavailable", msg)
+}
+
 // TimeoutErrorResp responds a error JSON because of operation timeout.
 func TimeoutErrorResp(c *Context, msg string) {
-	if msg == "" {
-		msg = http.StatusText(http.StatusGatewayTimeout)
-	}
 	errResp(c, http.StatusGatewayTimeout, "TimeoutError", msg)
 }
@@ -39,7 +39,10 @@ func TestErrResps(t *testing.T) {
 		{"GET", "/authenticationexpired", nil, nil, func(c *Context) { AuthenticationExpiredResp(c, "") }, http.StatusUnauthorized, `{"error":{"code":"AuthenticationExpired","msg":"Authentication Expired"}}`},
 		{"GET", "/forbidden", nil, nil, func(c *Context) { ForbiddenResp(c, "") }, http.StatusForbidden, `{"error":{"code":"Forbidden","msg":"Forbidden"}}`},
 		{"GET", "/notfound", nil, nil, func(c *Context) { NotFoundResp(c, "") }, http.StatusNotFound, `{"error":{"code":"NotFound","msg":"Not Found"}}`},
+		{"GET", "/conflict", nil, nil, func(c *Context) { ConflictResp(c, "") }, http.StatusConflict, `{"error":{"code":"Conflict","msg":"Conflict"}}`},
+		{"GET", "/toomanyrequests", nil, nil, func(c *Context) { TooManyRequestsResp(c, "") }, http.StatusTooManyRequests, `{"error":{"code":"TooManyRequests","msg":"Too Many Requests"}}`},
 		{"GET", "/internalservererror", nil, nil, func(c *Context) { InternalServerErrorResp(c, "") }, http.StatusInternalServerError, `{"error":{"code":"InternalServerError","msg":"Internal Server Error"}}`},
+		{"GET", "/serviceunavailable", nil, nil, func(c *Context) { ServiceUnavailableResp(c, "") }, http.StatusServiceUnavailable, `{"error":{"code":"ServiceUnavailable","msg":"Service Unavailable"}}`},
 		{"GET", "/timeouterror", nil, nil, func(c *Context) { TimeoutErrorResp(c, "") }, http.StatusGatewayTimeout, `{"error":{"code":"TimeoutError","msg":"Gateway Timeout"}}`},
 	}
 	h := gin.New()
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker checks a dependency of server. It should return before ctx is done.
+type HealthChecker func(ctx context.Context) error
+
+// healthCheck is a named HealthChecker with its timeout.
+type healthCheck struct {
+	name    string
+	timeout time.Duration
+	checker HealthChecker
+}
+
+// healthResult is the result of a healthCheck.
+type healthResult struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Latency   string `json:"latency"`
+	Error     string `json:"error,omitempty"`
+	checkedAt time.Time
+}
+
+// healthReport is the JSON responded by /healthz and /readyz.
+type healthReport struct {
+	Status string          `json:"status"`
+	Checks []*healthResult `json:"checks"`
+}
+
+// healthCache keeps the latest results of health checks, keyed by the kind and the name
+// of the check, since a liveness check and a readiness check may have the same name.
+type healthCache struct {
+	mu      sync.Mutex
+	results map[string]*healthResult
+}
+
+// storeHealthCheck is the readiness check registered by default if store is set.
+func (s *Server) storeHealthCheck() healthCheck {
+	return healthCheck{
+		name:    "store",
+		timeout: 2 * time.Second,
+		checker: func(ctx context.Context) error {
+			return s.pingStore(ctx)
+		},
+	}
+}
+
+// runHealthChecks runs checks of kind, liveness or readiness, concurrently. A result newer
+// than the cache TTL is reused.
+func (s *Server) runHealthChecks(kind string, checks []healthCheck) *healthReport {
+	report := &healthReport{
+		Status: "ok",
+		Checks: make([]*healthResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Checks[i] = s.runHealthCheck(kind, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != "ok" {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+// runHealthCheck runs the check with its timeout, or returns the cached result.
+func (s *Server) runHealthCheck(kind string, check healthCheck) *healthResult {
+	key := kind + "/" + check.name
+	s.healthCache.mu.Lock()
+	cached, ok := s.healthCache.results[key]
+	s.healthCache.mu.Unlock()
+	if ok && time.Since(cached.checkedAt) < s.healthCacheTTL {
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), check.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- check.checker(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("timeout after %s", check.timeout)
+	}
+
+	result := &healthResult{
+		Name:      check.name,
+		Status:    "ok",
+		Latency:   time.Since(start).String(),
+		checkedAt: time.Now(),
+	}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+
+	s.healthCache.mu.Lock()
+	s.healthCache.results[key] = result
+	s.healthCache.mu.Unlock()
+	return result
+}
+
+// healthResp responds the report with 200, or 503 if any check fails.
+func (s *Server) healthResp(c *Context, report *healthReport) {
+	if report.Status != "ok" {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// livenessHandler deals with [GET] /healthz.
+func (s *Server) livenessHandler(c *Context) {
+	s.healthResp(c, s.runHealthChecks("liveness", s.livenessChecks))
+}
+
+// readinessHandler deals with [GET] /readyz. It fails once the server is shutting down.
+func (s *Server) readinessHandler(c *Context) {
+	checks := s.readinessChecks
+	if s.store != nil {
+		checks = append([]healthCheck{s.storeHealthCheck()}, checks...)
+	}
+	report := s.runHealthChecks("readiness", checks)
+	if !s.Ready() {
+		report.Status = "fail"
+		report.Checks = append(report.Checks, &healthResult{
+			Name:    "shutdown",
+			Status:  "fail",
+			Latency: time.Duration(0).String(),
+			Error:   "server is shutting down",
+		})
+	}
+	s.healthResp(c, report)
+}
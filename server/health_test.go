@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikunalpha/httpsrvtpl/store/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	var reportFunc = func(body string) *healthReport {
+		report := &healthReport{}
+		err := json.Unmarshal([]byte(body), report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	var cacheCalled int32
+	st := mock.New()
+	s := New("127.0.0.1:0",
+		OptStore(st),
+		OptAddHealthHandler(), OptAddHealthHandler(), // for coverage
+		OptHealthCacheTTL(200*time.Millisecond),
+		OptLivenessCheck("goroutines", time.Second, func(ctx context.Context) error { return nil }),
+		OptReadinessCheck("cache", 100*time.Millisecond, func(ctx context.Context) error {
+			atomic.AddInt32(&cacheCalled, 1)
+			return nil
+		}),
+	)
+
+	// Test liveness
+	status, respBody := sendRequestFunc(s.handler, "GET", "/healthz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	report := reportFunc(respBody)
+	assert.Equal(t, "ok", report.Status, "should be equal")
+	assert.Equal(t, 1, len(report.Checks), "should be equal")
+	assert.Equal(t, "goroutines", report.Checks[0].Name, "should be equal")
+
+	// Test readiness with store checked by default
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	report = reportFunc(respBody)
+	assert.Equal(t, "ok", report.Status, "should be equal")
+	assert.Equal(t, 2, len(report.Checks), "should be equal")
+	assert.Equal(t, "store", report.Checks[0].Name, "should be equal")
+	assert.Equal(t, "ok", report.Checks[0].Status, "should be equal")
+	assert.Equal(t, "cache", report.Checks[1].Name, "should be equal")
+	assert.NotEqual(t, "", report.Checks[1].Latency, "should not be equal")
+
+	// Test cached results
+	st.Close()
+	status, _ = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cacheCalled), "should be equal")
+
+	// Test failed store after cache expired
+	time.Sleep(250 * time.Millisecond)
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	report = reportFunc(respBody)
+	assert.Equal(t, "fail", report.Status, "should be equal")
+	assert.Equal(t, "fail", report.Checks[0].Status, "should be equal")
+	assert.Equal(t, "connection failed", report.Checks[0].Error, "should be equal")
+	assert.Equal(t, "ok", report.Checks[1].Status, "should be equal")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&cacheCalled), "should be equal")
+
+	// Test timeout and error of checks
+	s = New("127.0.0.1:0",
+		OptAddHealthHandler(),
+		OptHealthCacheTTL(0),
+		OptLivenessCheck("slow", 50*time.Millisecond, func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}),
+		OptReadinessCheck("broken", time.Second, func(ctx context.Context) error { return errors.New("broken") }),
+	)
+	start := time.Now()
+	status, respBody = sendRequestFunc(s.handler, "GET", "/healthz", nil, nil)
+	assert.Equal(t, true, time.Since(start) < 500*time.Millisecond, "should be true")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	assert.Equal(t, "timeout after 50ms", reportFunc(respBody).Checks[0].Error, "should be equal")
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	assert.Equal(t, "broken", reportFunc(respBody).Checks[0].Error, "should be equal")
+
+	// Test a liveness check and a readiness check of the same name are cached apart
+	s = New("127.0.0.1:0",
+		OptStore(mock.New()),
+		OptAddHealthHandler(),
+		OptHealthCacheTTL(time.Minute),
+		OptLivenessCheck("store", time.Second, func(ctx context.Context) error { return errors.New("stuck") }),
+	)
+	status, _ = sendRequestFunc(s.handler, "GET", "/healthz", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "ok", reportFunc(respBody).Checks[0].Status, "should be equal")
+	status, respBody = sendRequestFunc(s.handler, "GET", "/healthz", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	assert.Equal(t, "stuck", reportFunc(respBody).Checks[0].Error, "should be equal")
+
+	// Test the store is pinged with the context of the check
+	hs := &hangingStore{}
+	s = New("127.0.0.1:0", OptStore(hs), OptAddHealthHandler(), OptHealthCacheTTL(0))
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	assert.Equal(t, "timeout after 2s", reportFunc(respBody).Checks[0].Error, "should be equal")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hs.returned), "should be equal")
+
+	// Test readiness fails when shutting down
+	s = New("127.0.0.1:0", OptAddHealthHandler())
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, `{"status":"ok","checks":[]}`, respBody, "should be equal")
+	err := s.Run()
+	assert.Nil(t, err, "should be nil")
+	go s.Stop()
+	time.Sleep(50 * time.Millisecond)
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "should be equal")
+	assert.Equal(t, "shutdown", reportFunc(respBody).Checks[0].Name, "should be equal")
+}
+
+// hangingStore is a store.Store whose Ping hangs until ctx is done.
+type hangingStore struct {
+	returned int32
+}
+
+func (s *hangingStore) Ping(ctx context.Context) error {
+	<-ctx.Done()
+	atomic.StoreInt32(&s.returned, 1)
+	return ctx.Err()
+}
+
+func (s *hangingStore) Close() {}
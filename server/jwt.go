@@ -0,0 +1,150 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// ContextKeyJWTClaims is the key of parsed JWT claims stored in Context.
+const ContextKeyJWTClaims = "jwtClaims"
+
+var (
+	errJWTMissing  = errors.New("jwt: missing bearer token")
+	errJWTExpired  = errors.New("jwt: token is expired")
+	errJWTNotValid = errors.New("jwt: token is not valid yet")
+	errJWTIssuer   = errors.New("jwt: invalid issuer")
+	errJWTAudience = errors.New("jwt: invalid audience")
+)
+
+// JWTAuthConfig contains the settings used to validate a JWT.
+type JWTAuthConfig struct {
+	// Algorithm is one of HS256, RS256 or ES256.
+	Algorithm string
+	// Key is []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256.
+	Key interface{}
+	// Issuer is checked against the "iss" claim if it is not empty.
+	Issuer string
+	// Audience is checked against the "aud" claim if it is not empty.
+	Audience string
+	// Leeway is the tolerance of clock skew when checking "exp", "nbf" and "iat".
+	Leeway time.Duration
+}
+
+// JWTClaims returns the JWT claims stored in Context by the jwt auth middleware.
+func JWTClaims(c *Context) (jwt.MapClaims, bool) {
+	v, ok := c.Get(ContextKeyJWTClaims)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(jwt.MapClaims)
+	return claims, ok
+}
+
+// jwtAuth is the middleware which validates the bearer token of a request. It can be
+// attached to the routes groups in addRoutes.
+func (s *Server) jwtAuth() HandlerFunc {
+	return func(c *Context) {
+		if s.jwtAuthConfig == nil {
+			s.internalServerErrorResp(c, errors.New("jwt: auth is not configured"), "")
+			c.Abort()
+			return
+		}
+
+		claims, err := s.jwtAuthConfig.parse(c.GetHeader("Authorization"))
+		if err == errJWTExpired {
+			s.authenticationExpiredResp(c, err, "")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			s.authenticationErrorResp(c, err, "")
+			c.Abort()
+			return
+		}
+
+		c.Set(ContextKeyJWTClaims, claims)
+		c.Next()
+	}
+}
+
+// parse extracts the bearer token from the Authorization header and validates it.
+func (cfg *JWTAuthConfig) parse(authorization string) (jwt.MapClaims, error) {
+	const prefix = "Bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return nil, errJWTMissing
+	}
+
+	parser := &jwt.Parser{
+		ValidMethods:         []string{cfg.Algorithm},
+		SkipClaimsValidation: true,
+	}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(strings.TrimSpace(authorization[len(prefix):]), claims, cfg.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, cfg.validate(claims)
+}
+
+// keyFunc returns the verification key after checking it matches the algorithm.
+func (cfg *JWTAuthConfig) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch cfg.Algorithm {
+	case "HS256":
+		if key, ok := cfg.Key.([]byte); ok {
+			return key, nil
+		}
+	case "RS256":
+		if key, ok := cfg.Key.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case "ES256":
+		if key, ok := cfg.Key.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	default:
+		return nil, fmt.Errorf("jwt: unsupported algorithm %s", cfg.Algorithm)
+	}
+	return nil, fmt.Errorf("jwt: invalid key type %T for %s", cfg.Key, cfg.Algorithm)
+}
+
+// validate checks the registered claims with leeway.
+func (cfg *JWTAuthConfig) validate(claims jwt.MapClaims) error {
+	now := time.Now()
+	leeway := int64(cfg.Leeway / time.Second)
+
+	if !claims.VerifyExpiresAt(now.Unix()-leeway, false) {
+		return errJWTExpired
+	}
+	if !claims.VerifyNotBefore(now.Unix()+leeway, false) || !claims.VerifyIssuedAt(now.Unix()+leeway, false) {
+		return errJWTNotValid
+	}
+	if cfg.Issuer != "" && !claims.VerifyIssuer(cfg.Issuer, true) {
+		return errJWTIssuer
+	}
+	if cfg.Audience != "" && !verifyAudience(claims["aud"], cfg.Audience) {
+		return errJWTAudience
+	}
+	return nil
+}
+
+// verifyAudience accepts "aud" claim as a string or an array of strings.
+func verifyAudience(aud interface{}, cmp string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == cmp
+	case []interface{}:
+		for i := range v {
+			if s, ok := v[i].(string); ok && s == cmp {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTAuth(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	var signFunc = func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	var meHandler = func(c *Context) {
+		claims, _ := JWTClaims(c)
+		c.String(http.StatusOK, claims["sub"].(string))
+	}
+
+	now := time.Now().Unix()
+	secret := []byte("secret")
+
+	// Test HS256 with issuer, audience and leeway
+	s := New("0.0.0.0:8888", OptJWTAuth(JWTAuthConfig{
+		Algorithm: "HS256",
+		Key:       secret,
+		Issuer:    "httpsrvtpl",
+		Audience:  "api",
+		Leeway:    30 * time.Second,
+	}))
+	s.addRoutes("/api", []HandlerFunc{s.jwtAuth()}, []route{
+		{"GET", "/me", meHandler},
+	})
+
+	type testCase struct {
+		Headers            H
+		ExpectedStatusCode int
+		ExpectedBodyString string
+	}
+	testCases := []testCase{
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": "api", "exp": now + 60})}, http.StatusOK, "mikun"},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": []string{"web", "api"}})}, http.StatusOK, "mikun"},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": "api", "exp": now - 10})}, http.StatusOK, "mikun"},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": "api", "exp": now - 60})}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationExpired","msg":"Authentication Expired","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": "api", "nbf": now + 60})}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "other", "aud": "api"})}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": "web"})}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc", "Authorization": signFunc(jwt.SigningMethodHS256, []byte("wrong"), jwt.MapClaims{"sub": "mikun", "iss": "httpsrvtpl", "aud": "api"})}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc", "Authorization": "Bearer abc.def.ghi"}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc", "Authorization": "Basic abc"}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{H{"X-Request-ID": "abc"}, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+	}
+	for _, c := range testCases {
+		status, respBody := sendRequestFunc(s.handler, "GET", "/api/me", c.Headers, nil)
+		assert.Equal(t, c.ExpectedStatusCode, status, "should be equal")
+		assert.Equal(t, c.ExpectedBodyString, respBody, "should be equal")
+	}
+
+	// Test RS256
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New("0.0.0.0:8888", OptJWTAuth(JWTAuthConfig{Algorithm: "RS256", Key: &rsaKey.PublicKey}))
+	s.addRoutes("/api", []HandlerFunc{s.jwtAuth()}, []route{
+		{"GET", "/me", meHandler},
+	})
+	status, respBody := sendRequestFunc(s.handler, "GET", "/api/me", H{"Authorization": signFunc(jwt.SigningMethodRS256, rsaKey, jwt.MapClaims{"sub": "rsa"})}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "rsa", respBody, "should be equal")
+	// HS256 token signed with the public key must not pass RS256 validation
+	status, _ = sendRequestFunc(s.handler, "GET", "/api/me", H{"Authorization": signFunc(jwt.SigningMethodHS256, []byte("public"), jwt.MapClaims{"sub": "rsa"})}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status, "should be equal")
+
+	// Test ES256
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New("0.0.0.0:8888", OptJWTAuth(JWTAuthConfig{Algorithm: "ES256", Key: &ecKey.PublicKey}))
+	s.addRoutes("/api", []HandlerFunc{s.jwtAuth()}, []route{
+		{"GET", "/me", meHandler},
+	})
+	status, respBody = sendRequestFunc(s.handler, "GET", "/api/me", H{"Authorization": signFunc(jwt.SigningMethodES256, ecKey, jwt.MapClaims{"sub": "ecdsa"})}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "ecdsa", respBody, "should be equal")
+
+	// Test wrong key type
+	s = New("0.0.0.0:8888", OptJWTAuth(JWTAuthConfig{Algorithm: "ES256", Key: secret}))
+	s.addRoutes("/api", []HandlerFunc{s.jwtAuth()}, []route{
+		{"GET", "/me", meHandler},
+	})
+	status, _ = sendRequestFunc(s.handler, "GET", "/api/me", H{"Authorization": signFunc(jwt.SigningMethodES256, ecKey, jwt.MapClaims{"sub": "ecdsa"})}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status, "should be equal")
+
+	// Test not configured
+	s = New("0.0.0.0:8888")
+	s.addRoutes("/api", []HandlerFunc{s.jwtAuth()}, []route{
+		{"GET", "/me", meHandler},
+	})
+	status, _ = sendRequestFunc(s.handler, "GET", "/api/me", nil, nil)
+	assert.Equal(t, http.StatusInternalServerError, status, "should be equal")
+}
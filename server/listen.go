@@ -0,0 +1,310 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation. It is a
+// variable for tests.
+var listenFDsStart = 3
+
+// inheritedFiles keeps the files of the inherited file descriptors open, so the server
+// can listen on them again after Stop. The environment of socket activation is read once
+// and unset, so child processes do not take the file descriptors as theirs.
+var inheritedFiles = struct {
+	mu     sync.Mutex
+	loaded bool
+	names  []string
+	files  map[int]*os.File
+}{files: map[int]*os.File{}}
+
+// listen binds the addresses of OptListen, or the address of the server if there is
+// none. The bound listeners are closed if any of the addresses fails.
+func (s *Server) listen() ([]net.Listener, error) {
+	addresses := s.listenAddresses
+	if len(addresses) == 0 {
+		addresses = []string{s.address}
+	}
+
+	lns := []net.Listener{}
+	for _, address := range addresses {
+		l, err := listenAddress(address)
+		if err != nil {
+			closeListeners(lns)
+			return nil, fmt.Errorf("listen on %s failed: %v", address, err)
+		}
+		lns = append(lns, l...)
+	}
+	return lns, nil
+}
+
+// listenAddress binds address, which is host:port, tcp://host:port, unix://path or
+// fd://[name]. See OptListen.
+func listenAddress(address string) ([]net.Listener, error) {
+	scheme := "tcp"
+	if i := strings.Index(address, "://"); i >= 0 {
+		scheme = address[:i]
+	}
+
+	switch scheme {
+	case "tcp":
+		ln, err := net.Listen("tcp", strings.TrimPrefix(address, "tcp://"))
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	case "unix":
+		ln, err := listenUnix(address)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	case "fd":
+		return listenFDs(strings.TrimPrefix(address, "fd://"))
+	}
+	return nil, fmt.Errorf("unknown scheme %s", scheme)
+}
+
+// listenUnix binds the Unix socket of address like unix:///run/app.sock?mode=0660, or an
+// abstract socket like unix://@app. The query may set the mode, the user and the group of
+// the socket file, where the user and the group are names or IDs. A stale socket file is
+// removed first.
+func listenUnix(address string) (net.Listener, error) {
+	// The address is not parsed as a URL, which takes @ as the end of userinfo
+	path := strings.TrimPrefix(address, "unix://")
+	rawQuery := ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, rawQuery = path[:i], path[i+1:]
+	}
+	if path == "" || path == "@" {
+		return nil, errors.New("no socket path")
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(path, "@") {
+		if len(query) > 0 {
+			return nil, errors.New("abstract socket has no mode or owner")
+		}
+		return net.Listen("unix", path)
+	}
+
+	var mode os.FileMode
+	if m := query.Get("mode"); m != "" {
+		n, err := strconv.ParseUint(m, 8, 32)
+		if err != nil || n > 0777 {
+			return nil, fmt.Errorf("invalid mode %s", m)
+		}
+		mode = os.FileMode(n)
+	}
+	uid, err := lookupID(query.Get("user"), func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	gid, err := lookupID(query.Get("group"), func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = removeStaleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+	return listenUnixSocket(path, mode, uid, gid)
+}
+
+// listenUnixSocket binds the Unix socket of path, and sets its mode and owner if mode is
+// not 0 or the IDs are not -1. The socket is bound in a private directory next to path,
+// and renamed to path after its mode and owner are set, so other users can not connect
+// in between.
+func listenUnixSocket(path string, mode os.FileMode, uid, gid int) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The socket file is removed by unixListener, since it is moved
+	ln.SetUnlinkOnClose(false)
+	if uid >= 0 || gid >= 0 {
+		err = os.Chown(tmp, uid, gid)
+	}
+	if err == nil && mode != 0 {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: ln, path: path}, nil
+}
+
+// unixListener is the listener of a Unix socket renamed to path. It removes the socket
+// file when it is closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+// Addr returns the address of path instead of the one bound.
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// Close closes the listener and removes the socket file.
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+	return err
+}
+
+// lookupID returns the ID of name, which is an ID or a name looked up by lookup. It
+// returns -1 if name is empty.
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// removeStaleSocket removes the socket file of path if nothing is listening on it, e.g.
+// when the previous process crashed. It fails if the socket is in use or path is not a
+// socket.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	logger.Infof("remove stale socket %s", path)
+	return os.Remove(path)
+}
+
+// listenFDs returns the listeners of the file descriptors passed by socket activation,
+// e.g. systemd, which sets LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES. All of them are
+// returned if name is empty, otherwise the ones named name.
+func listenFDs(name string) ([]net.Listener, error) {
+	inheritedFiles.mu.Lock()
+	defer inheritedFiles.mu.Unlock()
+	if !inheritedFiles.loaded {
+		inheritedFiles.loaded = true
+		inheritedFiles.names = loadListenFDs()
+	}
+	names := inheritedFiles.names
+	if len(names) == 0 {
+		return nil, errors.New("no file descriptor is passed to the process")
+	}
+
+	lns := []net.Listener{}
+	for i := range names {
+		if name != "" && names[i] != name {
+			continue
+		}
+		fd := listenFDsStart + i
+		ln, err := net.FileListener(inheritedFiles.files[fd])
+		if err != nil {
+			closeListeners(lns)
+			return nil, fmt.Errorf("file descriptor %d: %v", fd, err)
+		}
+		lns = append(lns, ln)
+	}
+	if len(lns) == 0 {
+		return nil, fmt.Errorf("no file descriptor is named %s", name)
+	}
+	return lns, nil
+}
+
+// loadListenFDs opens the file descriptors passed to the process, sets them close on
+// exec, and unsets the environment of socket activation. It returns the names of the file
+// descriptors in order, where the unnamed ones are empty. The caller must hold
+// inheritedFiles.mu.
+func loadListenFDs() []string {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+
+	names := make([]string, n)
+	copy(names, strings.Split(os.Getenv("LISTEN_FDNAMES"), ":"))
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		closeOnExec(fd)
+		if _, ok := inheritedFiles.files[fd]; !ok {
+			inheritedFiles.files[fd] = os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		}
+	}
+	return names
+}
+
+// closeListeners closes lns.
+func closeListeners(lns []net.Listener) {
+	for _, ln := range lns {
+		ln.Close()
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package server
+
+// closeOnExec does nothing, since file descriptors are not inherited on this platform
+// unless asked for.
+func closeOnExec(fd int) {}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListen(t *testing.T) {
+	var getFunc = func(client *http.Client, url string) (int, string, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), err
+	}
+	var unixClient = func(path string) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+	}
+
+	sock := filepath.Join(t.TempDir(), "srv.sock")
+	s := New("0.0.0.0:8888", OptListen("127.0.0.1:0"), OptListen("tcp://127.0.0.1:0"), OptListen("unix://"+sock+"?mode=0600"), OptAddPingHandler())
+	err := s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	addrs := s.Addrs()
+	assert.Equal(t, 3, len(addrs), "should be equal")
+	assert.Equal(t, s.Addr(), addrs[0], "should be equal")
+
+	// Test all listeners serve the same handler
+	for _, addr := range addrs[:2] {
+		status, respBody, err := getFunc(http.DefaultClient, "http://"+addr.String()+"/ping")
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, http.StatusOK, status, "should be equal")
+		assert.Equal(t, `{"ping":"pong"}`, respBody, "should be equal")
+	}
+	client := unixClient(sock)
+	status, respBody, err := getFunc(client, "http://unix/ping")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, `{"ping":"pong"}`, respBody, "should be equal")
+	fi, err := os.Stat(sock)
+	if assert.Nil(t, err, "should be nil") {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "should be equal")
+	}
+	// Test the private directory the socket is bound in is removed
+	files, err := ioutil.ReadDir(filepath.Dir(sock))
+	if assert.Nil(t, err, "should be nil") {
+		assert.Equal(t, 1, len(files), "should be equal")
+	}
+
+	// Test an abstract socket, which has no file
+	abstract := fmt.Sprintf("@httpsrvtpl-test-%d", os.Getpid())
+	s3 := New("0.0.0.0:8888", OptListen("unix://"+abstract), OptAddPingHandler())
+	err = s3.Run()
+	if assert.Nil(t, err, "should be nil") {
+		status, _, err = getFunc(unixClient(abstract), "http://unix/ping")
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, http.StatusOK, status, "should be equal")
+		s3.Stop()
+	}
+
+	// Test a socket in use is not removed
+	s2 := New("0.0.0.0:8888", OptListen("unix://"+sock))
+	err = s2.Run()
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test all listeners are shut down together, and the socket file is removed
+	_, err = s.Stop()
+	assert.Nil(t, err, "should be nil")
+	_, _, err = getFunc(http.DefaultClient, "http://"+addrs[1].String()+"/ping")
+	assert.NotNil(t, err, "should not be nil")
+	client.CloseIdleConnections()
+	_, _, err = getFunc(client, "http://unix/ping")
+	assert.NotNil(t, err, "should not be nil")
+	_, err = os.Stat(sock)
+	assert.Equal(t, true, os.IsNotExist(err), "should be true")
+
+	// Test a stale socket is removed
+	ln, err := net.Listen("unix", sock)
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	s = New("0.0.0.0:8888", OptListen("unix://"+sock), OptAddPingHandler())
+	err = s.Run()
+	if assert.Nil(t, err, "should be nil") {
+		status, _, err = getFunc(unixClient(sock), "http://unix/ping")
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, http.StatusOK, status, "should be equal")
+		s.Stop()
+	}
+
+	// Test a failure of serving one listener stops the others
+	s = New("0.0.0.0:8888", OptListen("127.0.0.1:0"), OptListen("127.0.0.1:0"))
+	err = s.Run()
+	if assert.Nil(t, err, "should be nil") {
+		s.mu.Lock()
+		s.listeners[0].Close()
+		s.mu.Unlock()
+		select {
+		case <-s.Done():
+		case <-time.After(3 * time.Second):
+			t.Fatal("server should be done")
+		}
+		assert.NotNil(t, s.Err(), "should not be nil")
+		_, err = net.Dial("tcp", s.Addrs()[1].String())
+		assert.NotNil(t, err, "should not be nil")
+	}
+
+	// Test invalid addresses
+	file := filepath.Join(t.TempDir(), "file")
+	ioutil.WriteFile(file, nil, 0644)
+	for _, address := range []string{"udp://127.0.0.1:0", "unix://", "unix://@", "unix://@abstract?mode=0600", "unix://" + sock + "?mode=8", "unix://" + file, "fd://"} {
+		s = New("0.0.0.0:8888", OptListen("127.0.0.1:0"), OptListen(address))
+		err = s.Run()
+		assert.NotNil(t, err, address)
+	}
+}
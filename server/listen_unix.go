@@ -0,0 +1,10 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// closeOnExec keeps the file descriptor from being inherited by child processes.
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
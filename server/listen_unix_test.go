@@ -0,0 +1,88 @@
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenFDs(t *testing.T) {
+	// Pass a socket like systemd does, starting from the file descriptor of it
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	fd := int(f.Fd())
+	// Clear close on exec, which File sets, to test it is set for inherited ones
+	syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0)
+
+	var resetFunc = func() {
+		inheritedFiles.mu.Lock()
+		inheritedFiles.loaded = false
+		inheritedFiles.names = nil
+		inheritedFiles.files[fd] = f
+		inheritedFiles.mu.Unlock()
+	}
+	defer func(start int) {
+		listenFDsStart = start
+		inheritedFiles.mu.Lock()
+		inheritedFiles.loaded = false
+		inheritedFiles.names = nil
+		delete(inheritedFiles.files, fd)
+		inheritedFiles.mu.Unlock()
+		f.Close()
+	}(listenFDsStart)
+	resetFunc()
+	listenFDsStart = fd
+	t.Setenv("LISTEN_PID", fmt.Sprint(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "web")
+
+	for _, address := range []string{"fd://", "fd://web"} {
+		s := New("0.0.0.0:8888", OptListen(address), OptAddPingHandler())
+		err = s.Run()
+		if !assert.Nil(t, err, address) {
+			continue
+		}
+		assert.Equal(t, addr, s.Addr().String(), "should be equal")
+		resp, err := http.Get("http://" + addr + "/ping")
+		if assert.Nil(t, err, "should be nil") {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "should be equal")
+		}
+		_, err = s.Stop()
+		assert.Nil(t, err, "should be nil")
+	}
+
+	// Test the environment is unset, and the file descriptor is not inherited by children
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_, ok := os.LookupEnv(key)
+		assert.Equal(t, false, ok, key)
+	}
+	flags, _, _ := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+	assert.Equal(t, uintptr(syscall.FD_CLOEXEC), flags&syscall.FD_CLOEXEC, "should be equal")
+
+	// Test sockets of other names or processes
+	s := New("0.0.0.0:8888", OptListen("fd://admin"))
+	err = s.Run()
+	assert.NotNil(t, err, "should not be nil")
+	resetFunc()
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	s = New("0.0.0.0:8888", OptListen("fd://"))
+	err = s.Run()
+	assert.NotNil(t, err, "should not be nil")
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// logLevels is the response of /debug/loglevel. Components contains the levels in effect,
+// and Overrides contains the ones set apart from the default level.
+type logLevels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+	Overrides  map[string]string `json:"overrides"`
+}
+
+// logLevelRequest is the request of PUT /debug/loglevel.
+type logLevelRequest struct {
+	Component string `json:"component" form:"component"`
+	Level     string `json:"level" form:"level"`
+}
+
+// currentLogLevels returns the default level and the levels of components.
+func currentLogLevels() *logLevels {
+	levels := &logLevels{
+		Level:      log.GetLevel().String(),
+		Components: map[string]string{},
+		Overrides:  map[string]string{},
+	}
+	for _, name := range logging.Components() {
+		level, overridden := logging.ComponentLevel(name)
+		levels.Components[name] = level.String()
+		if overridden {
+			levels.Overrides[name] = level.String()
+		}
+	}
+	return levels
+}
+
+// getLogLevelHandler responds the default level and the levels of components.
+func (s *Server) getLogLevelHandler(c *Context) {
+	c.JSON(http.StatusOK, currentLogLevels())
+}
+
+// putLogLevelHandler sets the default level if component is empty, or overrides the level
+// of component. The override is removed if level is empty, and the component follows the
+// default level again.
+func (s *Server) putLogLevelHandler(c *Context) {
+	req := &logLevelRequest{}
+	err := BindAndValidate(c, req)
+	if err != nil {
+		s.apiErrorResp(c, err)
+		return
+	}
+
+	if req.Component != "" && !knownComponent(req.Component) {
+		s.invalidParameterResp(c, fmt.Errorf("unknown component %s", req.Component), "unknown component")
+		return
+	}
+	if req.Component != "" && req.Level == "" {
+		logging.ResetComponentLevel(req.Component)
+		logger.Infof("log level of %s is reset to the default", req.Component)
+		c.JSON(http.StatusOK, currentLogLevels())
+		return
+	}
+	level, err := log.ParseLevel(req.Level)
+	if err != nil {
+		s.invalidParameterResp(c, err, "unknown level")
+		return
+	}
+
+	if req.Component == "" {
+		logging.SetLevel(level)
+		logger.Infof("log level is set to %s", level)
+	} else {
+		logging.SetComponentLevel(req.Component, level)
+		logger.Infof("log level of %s is set to %s", req.Component, level)
+	}
+	c.JSON(http.StatusOK, currentLogLevels())
+}
+
+// knownComponent reports whether name is a component which has a logger.
+func knownComponent(name string) bool {
+	for _, n := range logging.Components() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevel(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	defer func(out io.Writer, level log.Level) {
+		log.SetOutput(out)
+		logging.SetLevel(level)
+		logging.ResetComponentLevel(logging.ComponentServer)
+	}(log.StandardLogger().Out, log.GetLevel())
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	logging.SetLevel(log.WarnLevel)
+
+	s := New("0.0.0.0:8888", OptAdminAllowIPs("192.0.2.1"), OptAddDebugHandler())
+	jsonHeaders := H{"Content-Type": "application/json"}
+
+	status, respBody := sendRequestFunc(s.handler, "GET", "/debug/loglevel", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Contains(t, respBody, `"level":"warning"`, "should contain")
+	assert.Contains(t, respBody, `"server":"warning"`, "should contain")
+	assert.Contains(t, respBody, `"overrides":{}`, "should contain")
+
+	// Test the level of a component is overridden
+	status, respBody = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"component":"server","level":"debug"}`))
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Contains(t, respBody, `"level":"warning"`, "should contain")
+	assert.Contains(t, respBody, `"overrides":{"server":"debug"}`, "should contain")
+	out.Reset()
+	sendRequestFunc(s.handler, "GET", "/api/notfound", nil, nil)
+	assert.Contains(t, out.String(), "NotFoundResp", "should contain")
+	assert.Contains(t, out.String(), "component=server", "should contain")
+
+	// Test the override is removed by an empty level
+	status, respBody = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"component":"server"}`))
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Contains(t, respBody, `"overrides":{}`, "should contain")
+	out.Reset()
+	sendRequestFunc(s.handler, "GET", "/api/notfound", nil, nil)
+	assert.Equal(t, "", out.String(), "should be equal")
+
+	// Test the default level is set without a component
+	status, respBody = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"level":"error"}`))
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Contains(t, respBody, `"level":"error"`, "should contain")
+	assert.Equal(t, log.ErrorLevel, log.GetLevel(), "should be equal")
+
+	// Test invalid requests
+	status, _ = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"level":"verbose"}`))
+	assert.Equal(t, http.StatusBadRequest, status, "should be equal")
+	status, _ = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"component":"nothing","level":"debug"}`))
+	assert.Equal(t, http.StatusBadRequest, status, "should be equal")
+	status, _ = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"level":`))
+	assert.Equal(t, http.StatusBadRequest, status, "should be equal")
+	assert.Equal(t, log.ErrorLevel, log.GetLevel(), "should be equal")
+
+	// Test the routes are guarded as admin routes
+	s = New("0.0.0.0:8888", OptAddDebugHandler())
+	status, _ = sendRequestFunc(s.handler, "PUT", "/debug/loglevel", jsonHeaders, strings.NewReader(`{"level":"debug"}`))
+	assert.Equal(t, http.StatusForbidden, status, "should be equal")
+	assert.Equal(t, log.ErrorLevel, log.GetLevel(), "should be equal")
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// contextKeyMessageCatalog is the key of the MessageCatalog of OptMessageCatalog.
+const contextKeyMessageCatalog = "messageCatalog"
+
+// MessageCatalog keeps the message templates of locales, keyed by error codes like
+// NotFound, validation rules like validation.required, or keys of custom messages.
+// Templates can contain parameters like {name}.
+type MessageCatalog struct {
+	mu            sync.RWMutex
+	defaultLocale string
+	messages      map[string]map[string]string
+	fallbacks     map[string][]string
+}
+
+// NewMessageCatalog returns an empty MessageCatalog. defaultLocale is the last locale
+// tried for any request, e.g. en.
+func NewMessageCatalog(defaultLocale string) *MessageCatalog {
+	return &MessageCatalog{
+		defaultLocale: strings.ToLower(defaultLocale),
+		messages:      make(map[string]map[string]string),
+		fallbacks:     make(map[string][]string),
+	}
+}
+
+// Add merges messages into the locale, e.g. zh-TW.
+func (mc *MessageCatalog) Add(locale string, messages map[string]string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	locale = strings.ToLower(locale)
+	if mc.messages[locale] == nil {
+		mc.messages[locale] = make(map[string]string)
+	}
+	for key, msg := range messages {
+		mc.messages[locale][key] = msg
+	}
+}
+
+// SetFallbacks sets the locales tried after the locale before its base language, e.g.
+// zh-HK falls back to zh-TW then zh.
+func (mc *MessageCatalog) SetFallbacks(locale string, fallbacks ...string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	locales := make([]string, len(fallbacks))
+	for i := range fallbacks {
+		locales[i] = strings.ToLower(fallbacks[i])
+	}
+	mc.fallbacks[strings.ToLower(locale)] = locales
+}
+
+// LoadFile adds the messages in a JSON or YAML file named by the locale, e.g. ja.yaml.
+// Nested keys are joined by dots, so {"validation":{"required":"..."}} is the message of
+// validation.required.
+func (mc *MessageCatalog) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var tree map[string]interface{}
+	ext := filepath.Ext(path)
+	switch ext {
+	case ".json":
+		err = json.Unmarshal(content, &tree)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	default:
+		return fmt.Errorf("unknown message file format %s", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s failed: %v", path, err)
+	}
+
+	messages := make(map[string]string)
+	flattenMessages("", tree, messages)
+	mc.Add(strings.TrimSuffix(filepath.Base(path), ext), messages)
+	return nil
+}
+
+// LoadDir loads all JSON and YAML files in dir by LoadFile.
+func (mc *MessageCatalog) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".json", ".yaml", ".yml":
+			err = mc.LoadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flattenMessages puts the leaves of tree into messages with keys joined by dots.
+func flattenMessages(prefix string, tree map[string]interface{}, messages map[string]string) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if sub, ok := value.(map[string]interface{}); ok {
+			flattenMessages(key, sub, messages)
+			continue
+		}
+		messages[key] = fmt.Sprint(value)
+	}
+}
+
+// Negotiate returns the locales tried for the Accept-Language header in order. Each
+// requested locale is followed by its fallbacks and base language, and the default
+// locale is the last one.
+func (mc *MessageCatalog) Negotiate(acceptLanguage string) []string {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	requested := []weighted{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		locale := strings.ToLower(strings.TrimSpace(fields[0]))
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, _ = strconv.ParseFloat(param[2:], 64)
+			}
+		}
+		if q > 0 {
+			requested = append(requested, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(requested, func(i, j int) bool { return requested[i].q > requested[j].q })
+
+	locales := []string{}
+	seen := map[string]bool{}
+	var expand func(locale string)
+	expand = func(locale string) {
+		if seen[locale] {
+			return
+		}
+		seen[locale] = true
+		locales = append(locales, locale)
+		for _, fallback := range mc.fallbacks[locale] {
+			expand(fallback)
+		}
+		if i := strings.Index(locale, "-"); i > 0 {
+			expand(locale[:i])
+		}
+	}
+	for _, r := range requested {
+		expand(r.locale)
+	}
+	if mc.defaultLocale != "" {
+		expand(mc.defaultLocale)
+	}
+	return locales
+}
+
+// Message returns the message of key in the first of locales which has it, with the
+// parameters filled in.
+func (mc *MessageCatalog) Message(locales []string, key string, params map[string]interface{}) (string, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	for _, locale := range locales {
+		if msg, ok := mc.messages[locale][key]; ok {
+			return formatMessage(msg, params), true
+		}
+	}
+	return "", false
+}
+
+// formatMessage replaces {name} in msg with params[name].
+func formatMessage(msg string, params map[string]interface{}) string {
+	if len(params) == 0 {
+		return msg
+	}
+	oldnew := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		oldnew = append(oldnew, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(oldnew...).Replace(msg)
+}
+
+// localize is the default middleware which passes the MessageCatalog of
+// OptMessageCatalog to the resp helpers through Context. It does nothing unless
+// OptMessageCatalog is set.
+func (s *Server) localize() HandlerFunc {
+	return func(c *Context) {
+		if s.messageCatalog != nil {
+			c.Set(contextKeyMessageCatalog, s.messageCatalog)
+		}
+		c.Next()
+	}
+}
+
+// lookupMessage returns the message of key in the locale negotiated by the
+// Accept-Language of the request.
+func lookupMessage(c *Context, key string, params map[string]interface{}) (string, bool) {
+	v, ok := c.Get(contextKeyMessageCatalog)
+	if !ok {
+		return "", false
+	}
+	mc := v.(*MessageCatalog)
+	return mc.Message(mc.Negotiate(c.GetHeader("Accept-Language")), key, params)
+}
+
+// Message returns the message of key localized for the request by the MessageCatalog of
+// OptMessageCatalog, with parameters filled in. It returns key if the message is not
+// found. It can be used for the custom messages of the resp helpers and APIError.
+//
+//	NotFoundResp(c, server.Message(c, "ItemNotFound", map[string]interface{}{"id": id}))
+func Message(c *Context, key string, params map[string]interface{}) string {
+	if msg, ok := lookupMessage(c, key, params); ok {
+		return msg
+	}
+	return key
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageCatalog(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "zh-TW.json"), []byte(`{
+		"NotFound": "找不到資源",
+		"ItemOutOfStock": "{name} 只剩 {count} 個",
+		"validation": {"required": "{field} 為必填"}
+	}`), 0644)
+	os.WriteFile(filepath.Join(dir, "ja.yaml"), []byte("NotFound: 見つかりません\nForbidden: 禁止されています\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "en.yml"), []byte("ItemOutOfStock: Only {count} {name} left\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# messages"), 0644)
+
+	mc := NewMessageCatalog("en")
+	err := mc.LoadDir(dir)
+	assert.Nil(t, err, "should be nil")
+	mc.SetFallbacks("zh-HK", "zh-TW")
+
+	// Test negotiation
+	assert.Equal(t, []string{"zh-tw", "zh", "en"}, mc.Negotiate("zh-TW"), "should be equal")
+	assert.Equal(t, []string{"ja", "zh-hk", "zh-tw", "zh", "en"}, mc.Negotiate("zh-HK;q=0.8, ja, fr;q=0"), "should be equal")
+	assert.Equal(t, []string{"en"}, mc.Negotiate(""), "should be equal")
+
+	// Test lookup
+	msg, ok := mc.Message(mc.Negotiate("zh-HK"), "ItemOutOfStock", map[string]interface{}{"name": "筆", "count": 3})
+	assert.Equal(t, true, ok, "should be true")
+	assert.Equal(t, "筆 只剩 3 個", msg, "should be equal")
+	msg, ok = mc.Message(mc.Negotiate("ja"), "ItemOutOfStock", map[string]interface{}{"name": "pens", "count": 3})
+	assert.Equal(t, true, ok, "should be true")
+	assert.Equal(t, "Only 3 pens left", msg, "should be equal")
+	_, ok = mc.Message(mc.Negotiate("ja"), "Unknown", nil)
+	assert.Equal(t, false, ok, "should be false")
+
+	// Test load errors
+	err = mc.LoadFile(filepath.Join(dir, "README.md"))
+	assert.NotNil(t, err, "should not be nil")
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{`), 0644)
+	err = mc.LoadFile(filepath.Join(dir, "bad.json"))
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test localized responses
+	type createItemReq struct {
+		Name string `json:"name" binding:"required"`
+	}
+	s := New("0.0.0.0:8888", OptMessageCatalog(mc))
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/items/:id", func(c *Context) { NotFoundResp(c, "") }},
+		{"GET", "/forbidden", func(c *Context) { c.Error(NewAPIError(http.StatusForbidden, "Forbidden", "")) }},
+		{"POST", "/items", func(c *Context) {
+			var req createItemReq
+			if err := BindAndValidate(c, &req); err != nil {
+				c.Error(err)
+				return
+			}
+			c.Status(http.StatusCreated)
+		}},
+		{"POST", "/orders", func(c *Context) {
+			InvalidParameterResp(c, Message(c, "ItemOutOfStock", map[string]interface{}{"name": "pens", "count": 0}))
+		}},
+	})
+
+	type testCase struct {
+		Method             string
+		Path               string
+		AcceptLanguage     string
+		RequestBody        io.Reader
+		ExpectedBodyString string
+	}
+	testCases := []testCase{
+		{"GET", "/api/items/1", "zh-TW,zh;q=0.9", nil, `{"error":{"code":"NotFound","msg":"找不到資源","request_id":"abc"}}`},
+		{"GET", "/api/items/1", "ja", nil, `{"error":{"code":"NotFound","msg":"見つかりません","request_id":"abc"}}`},
+		{"GET", "/api/items/1", "fr", nil, `{"error":{"code":"NotFound","msg":"Not Found","request_id":"abc"}}`},
+		{"GET", "/api/forbidden", "ja-JP", nil, `{"error":{"code":"Forbidden","msg":"禁止されています","request_id":"abc"}}`},
+		{"GET", "/nothing", "zh-HK", nil, `{"error":{"code":"NotFound","msg":"找不到資源","request_id":"abc"}}`},
+		{"POST", "/api/items", "zh-TW", strings.NewReader(`{}`), `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","details":[{"field":"name","rule":"required","message":"name 為必填"}],"request_id":"abc"}}`},
+		{"POST", "/api/items", "ja", strings.NewReader(`{}`), `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","details":[{"field":"name","rule":"required","message":"name is required"}],"request_id":"abc"}}`},
+		{"POST", "/api/orders", "zh-TW", nil, `{"error":{"code":"InvalidParameter","msg":"pens 只剩 0 個","request_id":"abc"}}`},
+		{"POST", "/api/orders", "", nil, `{"error":{"code":"InvalidParameter","msg":"Only 0 pens left","request_id":"abc"}}`},
+	}
+	for _, c := range testCases {
+		headers := H{"X-Request-ID": "abc", "Accept-Language": c.AcceptLanguage, "Content-Type": "application/json"}
+		_, respBody := sendRequestFunc(s.handler, c.Method, c.Path, headers, c.RequestBody)
+		assert.Equal(t, c.ExpectedBodyString, respBody, "should be equal")
+	}
+
+	// Test without catalog
+	s = New("0.0.0.0:8888")
+	s.addRoutes("/api", nil, []route{
+		{"POST", "/orders", func(c *Context) { InvalidParameterResp(c, Message(c, "ItemOutOfStock", nil)) }},
+	})
+	_, respBody := sendRequestFunc(s.handler, "POST", "/api/orders", H{"X-Request-ID": "abc", "Accept-Language": "zh-TW"}, nil)
+	assert.Equal(t, `{"error":{"code":"InvalidParameter","msg":"ItemOutOfStock","request_id":"abc"}}`, respBody, "should be equal")
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics contains the collectors exposed by OptMetrics.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requestsTotal    *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight *prometheus.GaugeVec
+
+	storePingDuration prometheus.Histogram
+	storeErrorsTotal  *prometheus.CounterVec
+}
+
+// newMetrics returns metrics registered to a new registry.
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		requestsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served.",
+		}, []string{"method", "route"}),
+		storePingDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "store_ping_duration_seconds",
+			Help:    "Latency of store Ping.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		storeErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "store_errors_total",
+			Help: "Total number of store errors.",
+		}, []string{"error"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestsTotal,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.storePingDuration,
+		m.storeErrorsTotal,
+	)
+	// Initialize the known errors, so they are exposed before any of them occurs
+	for _, label := range []string{"not_found", "duplicate", "connection_failed"} {
+		m.storeErrorsTotal.WithLabelValues(label)
+	}
+	return m
+}
+
+// instrument is the default middleware used to collect metrics of requests. It does
+// nothing unless OptMetrics is set. Requests are labeled by the route template, so
+// paths with parameters do not make too many series.
+func (s *Server) instrument() HandlerFunc {
+	return func(c *Context) {
+		if s.metrics == nil {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+
+		inFlight := s.metrics.requestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		status := strconv.Itoa(c.Writer.Status())
+		s.metrics.requestsTotal.WithLabelValues(method, route, status).Inc()
+		s.metrics.requestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsHandler deals with [GET] /metrics.
+func (s *Server) metricsHandler() HandlerFunc {
+	h := promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// pingStore pings the store within ctx and records the latency and error if OptMetrics
+// is set.
+func (s *Server) pingStore(ctx context.Context) error {
+	start := time.Now()
+	err := s.store.Ping(ctx)
+	if s.metrics != nil {
+		s.metrics.storePingDuration.Observe(time.Since(start).Seconds())
+	}
+	s.observeStoreError(err)
+	return err
+}
+
+// observeStoreError counts the error returned by store if OptMetrics is set.
+func (s *Server) observeStoreError(err error) {
+	if s.metrics == nil || err == nil {
+		return
+	}
+	label := "other"
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		label = "not_found"
+	case errors.Is(err, store.ErrDuplicate):
+		label = "duplicate"
+	case errors.Is(err, store.ErrConnectionFailed):
+		label = "connection_failed"
+	}
+	s.metrics.storeErrorsTotal.WithLabelValues(label).Inc()
+}
+
+// isStoreError reports whether err is one of the errors returned by store.
+func isStoreError(err error) bool {
+	return errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrDuplicate) || errors.Is(err, store.ErrConnectionFailed)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+	"github.com/mikunalpha/httpsrvtpl/store/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	st := mock.New()
+	s := New("127.0.0.1:0", OptAddPingHandler(), OptStore(st), OptAddHealthHandler(), OptMetrics(), OptMetrics())
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/users/:id", func(c *Context) { c.String(http.StatusOK, c.Param("id")) }},
+		{"GET", "/missing", func(c *Context) { c.Error(store.ErrNotFound) }},
+		{"POST", "/users", func(c *Context) { s.apiErrorResp(c, fmt.Errorf("create user: %w", store.ErrDuplicate)) }},
+		{"GET", "/panic", func(c *Context) { panic("panic") }},
+	})
+
+	sendRequestFunc(s.handler, "GET", "/ping", nil, nil)
+	sendRequestFunc(s.handler, "GET", "/api/users/1", nil, nil)
+	sendRequestFunc(s.handler, "GET", "/api/users/2", nil, nil)
+	sendRequestFunc(s.handler, "GET", "/nothing", nil, nil)
+	sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	sendRequestFunc(s.handler, "GET", "/api/missing", nil, nil)
+	sendRequestFunc(s.handler, "POST", "/api/users", nil, nil)
+	sendRequestFunc(s.handler, "GET", "/api/panic", nil, nil)
+	s.observeStoreError(store.ErrNotFound)
+	s.observeStoreError(store.ErrDuplicate)
+	s.observeStoreError(errors.New("other"))
+	s.observeStoreError(nil)
+
+	status, respBody := sendRequestFunc(s.handler, "GET", "/metrics", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Contains(t, respBody, `http_requests_total{method="GET",route="/ping",status="200"} 1`, "should contain")
+	assert.Contains(t, respBody, `http_requests_total{method="GET",route="/api/users/:id",status="200"} 2`, "should contain")
+	assert.Contains(t, respBody, `http_requests_total{method="GET",route="unmatched",status="404"} 1`, "should contain")
+	assert.Contains(t, respBody, `http_request_duration_seconds_count{method="GET",route="/api/users/:id",status="200"} 2`, "should contain")
+	assert.Contains(t, respBody, `http_requests_in_flight{method="GET",route="/metrics"} 1`, "should contain")
+	assert.Contains(t, respBody, `http_requests_in_flight{method="GET",route="/ping"} 0`, "should contain")
+	assert.Contains(t, respBody, `store_ping_duration_seconds_count 1`, "should contain")
+	assert.Contains(t, respBody, `http_requests_total{method="GET",route="/api/panic",status="500"} 1`, "should contain")
+	assert.Contains(t, respBody, `http_requests_total{method="GET",route="/api/missing",status="404"} 1`, "should contain")
+	assert.Contains(t, respBody, `store_errors_total{error="not_found"} 2`, "should contain")
+	assert.Contains(t, respBody, `store_errors_total{error="duplicate"} 2`, "should contain")
+	assert.Contains(t, respBody, `store_errors_total{error="connection_failed"} 0`, "should contain")
+	assert.Contains(t, respBody, `store_errors_total{error="other"} 1`, "should contain")
+	assert.Contains(t, respBody, `go_goroutines`, "should contain")
+
+	// Test store errors of Ping are counted
+	st.Close()
+	s.pingStore(context.Background())
+	_, respBody = sendRequestFunc(s.handler, "GET", "/metrics", nil, nil)
+	assert.Contains(t, respBody, `store_errors_total{error="connection_failed"} 1`, "should contain")
+
+	// Test nothing is collected without OptMetrics
+	s = New("127.0.0.1:0", OptAddPingHandler())
+	status, _ = sendRequestFunc(s.handler, "GET", "/ping", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	status, _ = sendRequestFunc(s.handler, "GET", "/metrics", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+}
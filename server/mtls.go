@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ContextKeyClientIdentity is the key of the verified client certificate identity stored
+// in Context.
+const ContextKeyClientIdentity = "clientIdentity"
+
+// ClientIdentity is the identity of a peer authenticated by its client certificate.
+type ClientIdentity struct {
+	Subject        string   `json:"subject"`
+	CommonName     string   `json:"common_name"`
+	DNSNames       []string `json:"dns_names,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+}
+
+// newClientIdentity returns the ClientIdentity of the certificate.
+func newClientIdentity(cert *x509.Certificate) *ClientIdentity {
+	id := &ClientIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for i := range cert.IPAddresses {
+		id.IPAddresses = append(id.IPAddresses, cert.IPAddresses[i].String())
+	}
+	for i := range cert.URIs {
+		id.URIs = append(id.URIs, cert.URIs[i].String())
+	}
+	return id
+}
+
+// ClientIdentityFromContext returns the ClientIdentity stored in Context by the
+// clientCertAuth middleware.
+func ClientIdentityFromContext(c *Context) (*ClientIdentity, bool) {
+	v, ok := c.Get(ContextKeyClientIdentity)
+	if !ok {
+		return nil, false
+	}
+	id, ok := v.(*ClientIdentity)
+	return id, ok
+}
+
+// clientCertAuth is the middleware which only allows peers presenting a client
+// certificate verified by the CA pool of OptTLSClientAuth. It can be attached to the
+// routes groups in addRoutes.
+func (s *Server) clientCertAuth() HandlerFunc {
+	return func(c *Context) {
+		cert, err := s.verifiedClientCert(c)
+		if err != nil {
+			s.forbiddenResp(c, err, "")
+			c.Abort()
+			return
+		}
+
+		c.Set(ContextKeyClientIdentity, newClientIdentity(cert))
+		c.Next()
+	}
+}
+
+// verifiedClientCert returns the client certificate of the request if it is verified.
+// The certificate is verified here if the TLS verification mode does not verify it.
+func (s *Server) verifiedClientCert(c *Context) (*x509.Certificate, error) {
+	state := c.Request.TLS
+	if state == nil {
+		return nil, errors.New("mtls: request is not over TLS")
+	}
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		return state.VerifiedChains[0][0], nil
+	}
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("mtls: no client certificate")
+	}
+	if s.tlsClientCAs == nil {
+		return nil, errors.New("mtls: client CA pool is not configured")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         s.tlsClientCAs,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("mtls: verify client certificate failed: %v", err)
+	}
+	return state.PeerCertificates[0], nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCertAuth(t *testing.T) {
+	// newCertFunc returns a certificate signed by parent, or self-signed if parent is nil
+	var newCertFunc = func(tpl *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+		tpl.NotBefore = time.Now().Add(-time.Hour)
+		tpl.NotAfter = time.Now().Add(time.Hour)
+		parentCert, parentKey := tpl, interface{}(key)
+		if parent != nil {
+			parentCert, parentKey = parent.Leaf, parent.PrivateKey
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, parentCert, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, _ := x509.ParseCertificate(der)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	}
+
+	ca := newCertFunc(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "internal-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	spiffe, _ := url.Parse("spiffe://internal/billing")
+	client := newCertFunc(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing", Organization: []string{"internal"}},
+		DNSNames:    []string{"billing.internal"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	stranger := newCertFunc(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "stranger"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	dir, err := os.MkdirTemp("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertFiles(t, certFile, keyFile, "server", time.Now().Add(time.Hour))
+
+	// sendRequestFunc always presents the given certificate even if it is not issued by the CA
+	var sendRequestFunc = func(addr string, cert *tls.Certificate) (int, string, error) {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: true,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if cert == nil {
+					return &tls.Certificate{}, nil
+				}
+				return cert, nil
+			},
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		req, _ := http.NewRequest("GET", "https://"+addr+"/internal/whoami", nil)
+		req.Header.Set("X-Request-ID", "abc")
+		resp, err := c.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), nil
+	}
+
+	for _, authType := range []tls.ClientAuthType{tls.VerifyClientCertIfGiven, tls.RequestClientCert} {
+		s := New("127.0.0.1:0", OptTLS(certFile, keyFile), OptTLSClientAuth(pool, authType))
+		s.addRoutes("/internal", []HandlerFunc{s.clientCertAuth()}, []route{
+			{"GET", "/whoami", func(c *Context) {
+				id, _ := ClientIdentityFromContext(c)
+				c.JSON(http.StatusOK, id)
+			}},
+		})
+		err = s.Run()
+		assert.Nil(t, err, "should be nil")
+
+		// Test verified peer
+		status, respBody, err := sendRequestFunc(s.Addr().String(), &client)
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, http.StatusOK, status, "should be equal")
+		assert.Equal(t, `{"subject":"CN=billing,O=internal","common_name":"billing","dns_names":["billing.internal"],"uris":["spiffe://internal/billing"]}`, respBody, "should be equal")
+
+		// Test peer without certificate
+		status, respBody, err = sendRequestFunc(s.Addr().String(), nil)
+		assert.Nil(t, err, "should be nil")
+		assert.Equal(t, http.StatusForbidden, status, "should be equal")
+		assert.Equal(t, `{"error":{"code":"Forbidden","msg":"Forbidden","request_id":"abc"}}`, respBody, "should be equal")
+
+		// Test peer with unknown certificate
+		status, _, err = sendRequestFunc(s.Addr().String(), &stranger)
+		if authType == tls.VerifyClientCertIfGiven {
+			assert.NotNil(t, err, "should not be nil")
+		} else {
+			assert.Nil(t, err, "should be nil")
+			assert.Equal(t, http.StatusForbidden, status, "should be equal")
+		}
+
+		s.Stop()
+	}
+
+	// Test request not over TLS
+	s := New("127.0.0.1:0")
+	s.addRoutes("/internal", []HandlerFunc{s.clientCertAuth()}, []route{
+		{"GET", "/whoami", func(c *Context) { c.String(http.StatusOK, "") }},
+	})
+	req := httptest.NewRequest("GET", "http://xxx.com/internal/whoami", nil)
+	respRecorder := httptest.NewRecorder()
+	s.handler.ServeHTTP(respRecorder, req)
+	assert.Equal(t, http.StatusForbidden, respRecorder.Code, "should be equal")
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
 	"net/http"
-	"net/http/pprof"
-	"strings"
+	"time"
 
 	"github.com/mikunalpha/httpsrvtpl/store"
 )
@@ -18,6 +20,93 @@ func OptAddress(address string) Option {
 	}
 }
 
+// OptListen adds an address the server listens on, instead of the address given to New.
+// It can be given multiple times, and all of the listeners serve the same handler, with
+// TLS if it is enabled. They are started by Run, which fails if any of them can not be
+// bound, and shut down together by Stop. The address is one of below.
+//
+// host:port or tcp://host:port
+//
+// unix:///run/app.sock?mode=0660&user=www-data&group=www-data, where the query is
+// optional and sets the mode and the owner of the socket file by names or IDs. Only the
+// owner can connect until they are set. A stale socket file left by a crashed process is
+// removed, and the file is removed by Stop. unix://@app is an abstract socket of Linux,
+// which has no file.
+//
+// fd:// or fd://name, the sockets passed by socket activation of systemd through
+// LISTEN_PID and LISTEN_FDS, or only the ones named name in LISTEN_FDNAMES. The variables
+// are unset, and the sockets are not inherited by child processes.
+func OptListen(address string) Option {
+	return func(s *Server) {
+		s.listenAddresses = append(s.listenAddresses, address)
+	}
+}
+
+// OptReadTimeout sets the maximum duration for reading the entire request. Default is
+// 10 seconds.
+func OptReadTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = timeout
+	}
+}
+
+// OptReadHeaderTimeout sets the maximum duration for reading the request headers. If it
+// is zero, the read timeout is used.
+func OptReadHeaderTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = timeout
+	}
+}
+
+// OptWriteTimeout sets the maximum duration before timing out writes of the response.
+// Default is 30 seconds.
+func OptWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = timeout
+	}
+}
+
+// OptIdleTimeout sets the maximum duration to wait for the next request when keep-alives
+// are enabled. Default is 120 seconds.
+func OptIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// OptMaxHeaderBytes sets the maximum size of request headers. If it is zero,
+// http.DefaultMaxHeaderBytes is used.
+func OptMaxHeaderBytes(n int) Option {
+	return func(s *Server) {
+		s.maxHeaderBytes = n
+	}
+}
+
+// OptShutdownTimeout sets how long Stop waits for in-flight requests before it force
+// closes the remaining connections. Default is 5 seconds.
+func OptShutdownTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// OptShutdownDelay sets how long Stop waits after the server turns unready before it
+// starts draining, so load balancers have time to stop routing new requests.
+func OptShutdownDelay(delay time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownDelay = delay
+	}
+}
+
+// OptOnShutdown adds a hook called after the server stops, e.g. closing the store or
+// flushing logs. Hooks are called in the order they are added, by Stop or when serving
+// fails, before Done is closed.
+func OptOnShutdown(hook func()) Option {
+	return func(s *Server) {
+		s.onShutdown = append(s.onShutdown, hook)
+	}
+}
+
 // OptAutoCert gets LetsEncrypt for domains automatically. If cacheDirPath is empty, it
 // will not cache any certs.
 func OptAutoCert(cacheDirPath string, domains ...string) Option {
@@ -28,6 +117,65 @@ func OptAutoCert(cacheDirPath string, domains ...string) Option {
 	}
 }
 
+// OptAutoCertDirectoryURL sets the ACME directory URL used by OptAutoCert. Default is
+// the Let's Encrypt production directory. It is useful to point to a staging or local
+// ACME server such as pebble.
+func OptAutoCertDirectoryURL(url string) Option {
+	return func(s *Server) {
+		s.autoCertDirectoryURL = url
+	}
+}
+
+// OptAutoCertHTTPAddress sets the address of the companion server used by OptAutoCert
+// which answers ACME HTTP-01 challenges and redirects HTTP to HTTPS. Default is ":80".
+func OptAutoCertHTTPAddress(address string) Option {
+	return func(s *Server) {
+		s.autoCertHTTPAddress = address
+	}
+}
+
+// OptTLS serves HTTPS with the certificate and key files. The certificate is reloaded
+// when the files change on disk or Server.ReloadCert is called.
+func OptTLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+	}
+}
+
+// OptTLSReloadInterval sets how often the files of OptTLS are checked for changes.
+// Default is 10 seconds. Zero disables the checking.
+func OptTLSReloadInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.tlsReloadInterval = interval
+	}
+}
+
+// OptTLSMinVersion sets the minimum TLS version, e.g. tls.VersionTLS12.
+func OptTLSMinVersion(version uint16) Option {
+	return func(s *Server) {
+		s.tlsMinVersion = version
+	}
+}
+
+// OptTLSCipherSuites sets the enabled cipher suites of TLS 1.0-1.2, e.g.
+// tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func OptTLSCipherSuites(suites ...uint16) Option {
+	return func(s *Server) {
+		s.tlsCipherSuites = suites
+	}
+}
+
+// OptTLSClientAuth sets the CA pool and the verification mode of client certificates
+// for OptTLS and OptAutoCert, e.g. tls.VerifyClientCertIfGiven. Attach
+// s.clientCertAuth() to the routes groups in addRoutes which only allow verified peers.
+func OptTLSClientAuth(clientCAs *x509.CertPool, authType tls.ClientAuthType) Option {
+	return func(s *Server) {
+		s.tlsClientCAs = clientCAs
+		s.tlsClientAuth = authType
+	}
+}
+
 // OptStore assigns the implementation of store.Store to server.
 func OptStore(st store.Store) Option {
 	return func(s *Server) {
@@ -35,6 +183,14 @@ func OptStore(st store.Store) Option {
 	}
 }
 
+// OptJWTAuth sets up the JWT validation used by the jwtAuth middleware. Attach
+// s.jwtAuth() to the routes groups in addRoutes which need authentication.
+func OptJWTAuth(cfg JWTAuthConfig) Option {
+	return func(s *Server) {
+		s.jwtAuthConfig = &cfg
+	}
+}
+
 // OptAllowMethodOverride allows a request override its method with header X-HTTP-Method-Override.
 func OptAllowMethodOverride() Option {
 	return func(s *Server) {
@@ -54,7 +210,8 @@ func OptAllowMethodOverride() Option {
 	}
 }
 
-// OptAddPingHandler add [GET] /ping route into router.
+// OptAddPingHandler add [GET] /ping route into router. It responds 503 once the server
+// is shutting down.
 func OptAddPingHandler() Option {
 	return func(s *Server) {
 		if s.hasPingHandler {
@@ -62,6 +219,12 @@ func OptAddPingHandler() Option {
 		}
 		s.hasPingHandler = true
 		s.routerEngine.GET("/ping", func(c *Context) {
+			if !s.Ready() {
+				c.JSON(http.StatusServiceUnavailable, &struct {
+					Ping string `json:"ping"`
+				}{"shutting down"})
+				return
+			}
 			c.JSON(http.StatusOK, &struct {
 				Ping string `json:"ping"`
 			}{"pong"})
@@ -69,7 +232,216 @@ func OptAddPingHandler() Option {
 	}
 }
 
-// OptAddDebugHandler add below routes into router.
+// OptLivenessCheck adds a named check to [GET] /healthz. The check fails if it does not
+// return within timeout.
+func OptLivenessCheck(name string, timeout time.Duration, checker HealthChecker) Option {
+	return func(s *Server) {
+		s.livenessChecks = append(s.livenessChecks, healthCheck{name, timeout, checker})
+	}
+}
+
+// OptReadinessCheck adds a named check to [GET] /readyz. The check fails if it does not
+// return within timeout. The Ping of store is checked by default.
+func OptReadinessCheck(name string, timeout time.Duration, checker HealthChecker) Option {
+	return func(s *Server) {
+		s.readinessChecks = append(s.readinessChecks, healthCheck{name, timeout, checker})
+	}
+}
+
+// OptHealthCacheTTL sets how long the result of a health check is reused. Default is 1
+// second.
+func OptHealthCacheTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.healthCacheTTL = ttl
+	}
+}
+
+// OptAddHealthHandler add below routes into router. They respond a JSON report of checks
+// with 200, or 503 if any check fails.
+// [GET] /healthz
+// [GET] /readyz
+func OptAddHealthHandler() Option {
+	return func(s *Server) {
+		if s.hasHealthHandler {
+			return
+		}
+		s.hasHealthHandler = true
+		s.routerEngine.GET("/healthz", s.livenessHandler)
+		s.routerEngine.GET("/readyz", s.readinessHandler)
+	}
+}
+
+// OptMetrics collects metrics of requests and store, and add [GET] /metrics route into
+// router which exposes them in Prometheus text format.
+func OptMetrics() Option {
+	return func(s *Server) {
+		if s.metrics != nil {
+			return
+		}
+		s.metrics = newMetrics()
+		s.routerEngine.GET("/metrics", s.metricsHandler())
+	}
+}
+
+// OptAccessLog logs completed requests in the format of cfg. It is not enabled if the
+// format is unknown.
+func OptAccessLog(cfg AccessLogConfig) Option {
+	return func(s *Server) {
+		accessLogger, err := newAccessLogger(cfg)
+		if err != nil {
+			logger.Errorf("OptAccessLog failed: %v", err)
+			return
+		}
+		s.accessLogger = accessLogger
+		s.accessLogConfig = cfg
+		s.accessLogExcludes = make(map[string]bool)
+		for _, path := range cfg.ExcludePaths {
+			s.accessLogExcludes[path] = true
+		}
+	}
+}
+
+// OptErrorFormat sets the format of error responses. The resp helpers and APIError are
+// responded in it. Default is ErrorFormatEnvelope.
+func OptErrorFormat(format ErrorFormat) Option {
+	return func(s *Server) {
+		switch format {
+		case ErrorFormatEnvelope, ErrorFormatProblem, ErrorFormatNegotiate:
+			s.errFormat = format
+		default:
+			logger.Errorf("OptErrorFormat failed: unknown error format %s", format)
+		}
+	}
+}
+
+// OptProblemTypeBaseURI sets the base URI of the type of problem+json, e.g. with
+// https://example.com/problems the type of NotFound is https://example.com/problems/NotFound.
+// Default type is about:blank.
+func OptProblemTypeBaseURI(uri string) Option {
+	return func(s *Server) {
+		s.problemTypeBaseURI = uri
+	}
+}
+
+// OptMessageCatalog localizes the messages of error responses by the Accept-Language of
+// requests. The default messages are used if the catalog has no message of a code.
+func OptMessageCatalog(mc *MessageCatalog) Option {
+	return func(s *Server) {
+		s.messageCatalog = mc
+	}
+}
+
+// OptPanicReporter adds a reporter which is notified of recovered panics. It can be used
+// multiple times.
+func OptPanicReporter(reporter PanicReporter) Option {
+	return func(s *Server) {
+		s.panicReporters = append(s.panicReporters, reporter)
+	}
+}
+
+// OptExposePanicStack responds the panic value and stack as the details of the error.
+// It is for development only, do not use it in production.
+func OptExposePanicStack() Option {
+	return func(s *Server) {
+		s.exposePanicStack = true
+	}
+}
+
+// OptCORS sets the default CORS policy of all routes. Preflight requests are responded
+// by the policy. It is not enabled if cfg is invalid.
+func OptCORS(cfg CORSConfig) Option {
+	return func(s *Server) {
+		policy, err := newCORSPolicy(cfg)
+		if err != nil {
+			logger.Errorf("OptCORS failed: %v", err)
+			return
+		}
+		s.corsPolicy = policy
+	}
+}
+
+// OptCORSPrefix sets the CORS policy of the routes under prefix, e.g. the prefix passed
+// to addRoutes. It overrides OptCORS, and the longest matching prefix wins. It is not
+// enabled if cfg is invalid.
+func OptCORSPrefix(prefix string, cfg CORSConfig) Option {
+	return func(s *Server) {
+		policy, err := newCORSPolicy(cfg)
+		if err != nil {
+			logger.Errorf("OptCORSPrefix %s failed: %v", prefix, err)
+			return
+		}
+		s.addCORSPrefixPolicy(prefix, policy)
+	}
+}
+
+// OptRateLimit limits all requests by cfg. Use s.rateLimit in addRoutes for the limits
+// of a routes group. It is not enabled if cfg is invalid.
+func OptRateLimit(cfg RateLimitConfig) Option {
+	return func(s *Server) {
+		l, err := newRateLimiter(cfg)
+		if err != nil {
+			logger.Errorf("OptRateLimit failed: %v", err)
+			return
+		}
+		s.rateLimiter = l
+	}
+}
+
+// OptAdminAddress serves admin routes, e.g. the ones of OptAddDebugHandler, on a separate
+// listener of address like 127.0.0.1:6060 instead of the default router. It is started
+// and stopped with the server. Admin routes on a loopback address are open to local
+// clients without guards, while the ones on other addresses still need OptAdminToken,
+// OptAdminBasicAuth or OptAdminAllowIPs.
+func OptAdminAddress(address string) Option {
+	return func(s *Server) {
+		s.adminAddress = address
+	}
+}
+
+// OptAdminToken sets the bearer token which admin routes accept.
+func OptAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// OptAdminBasicAuth sets the credentials of basic auth which admin routes accept.
+func OptAdminBasicAuth(username, password string) Option {
+	return func(s *Server) {
+		s.adminUsername = username
+		s.adminPassword = password
+	}
+}
+
+// OptAdminAllowIPs allows admin requests only from the IPs or CIDRs, e.g. 127.0.0.1 and
+// 10.0.0.0/8. The invalid ones are ignored, and no request is allowed if all of them are
+// invalid.
+func OptAdminAllowIPs(cidrs ...string) Option {
+	return func(s *Server) {
+		if s.adminAllowNets == nil {
+			s.adminAllowNets = []*net.IPNet{}
+		}
+		for _, cidr := range cidrs {
+			n, err := parseAllowNet(cidr)
+			if err != nil {
+				logger.Errorf("OptAdminAllowIPs failed: %v", err)
+				continue
+			}
+			s.adminAllowNets = append(s.adminAllowNets, n)
+		}
+	}
+}
+
+// OptAddReloadHandler add [POST] /admin/reload admin route. It calls reload, e.g. to
+// re-read the config and pass it to Reload, and responds 400 with the error if it fails.
+// It requires the credentials of OptAdminToken or OptAdminBasicAuth.
+func OptAddReloadHandler(reload func() error) Option {
+	return func(s *Server) {
+		s.reload = reload
+	}
+}
+
+// OptAddDebugHandler add below admin routes.
 // [GET] /debug/pprof
 // [GET] /debug/pprof/cmdline
 // [GET] /debug/pprof/profile
@@ -81,31 +453,16 @@ func OptAddPingHandler() Option {
 // [GET] /debug/heap
 // [GET] /debug/mutex
 // [GET] /debug/threadcreate
+// [GET] /debug/tls
+// [GET] /debug/loglevel
+// [PUT] /debug/loglevel, e.g. {"component":"store","level":"debug"} overrides the level of
+// the store component, and {"level":"warning"} sets the default level
+//
+// Admin routes are guarded by OptAdminAllowIPs, OptAdminToken and OptAdminBasicAuth, and
+// they are forbidden on the default router if none of them is set. Use OptAdminAddress
+// to serve them on a separate listener.
 func OptAddDebugHandler() Option {
-	httpToGin := func(h http.HandlerFunc) HandlerFunc {
-		handler := h
-		return func(c *Context) {
-			handler.ServeHTTP(c.Writer, c.Request)
-		}
-	}
-	pprofIndex := func(c *Context) {
-		pprof.Handler(strings.TrimPrefix(c.Request.URL.Path, "/debug/")).ServeHTTP(c.Writer, c.Request)
-	}
 	return func(s *Server) {
-		if s.hasDebugHandler {
-			return
-		}
 		s.hasDebugHandler = true
-		s.routerEngine.GET("/debug/pprof", httpToGin(pprof.Index))
-		s.routerEngine.GET("/debug/pprof/cmdline", httpToGin(pprof.Cmdline))
-		s.routerEngine.GET("/debug/pprof/profile", httpToGin(pprof.Profile))
-		s.routerEngine.GET("/debug/pprof/symbol", httpToGin(pprof.Symbol))
-		s.routerEngine.POST("/debug/pprof/symbol", httpToGin(pprof.Symbol))
-		s.routerEngine.GET("/debug/pprof/trace", httpToGin(pprof.Trace))
-		s.routerEngine.GET("/debug/block", pprofIndex)
-		s.routerEngine.GET("/debug/goroutine", pprofIndex)
-		s.routerEngine.GET("/debug/heap", pprofIndex)
-		s.routerEngine.GET("/debug/mutex", pprofIndex)
-		s.routerEngine.GET("/debug/threadcreate", pprofIndex)
 	}
 }
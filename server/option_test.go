@@ -1,10 +1,15 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mikunalpha/httpsrvtpl/store/mock"
 	"github.com/stretchr/testify/assert"
@@ -27,10 +32,33 @@ func TestServerOptions(t *testing.T) {
 
 	opts := []Option{
 		OptAddress("0.0.0.0:9876"),
+		OptReadTimeout(time.Second),
+		OptReadHeaderTimeout(2 * time.Second),
+		OptWriteTimeout(3 * time.Second),
+		OptIdleTimeout(4 * time.Second),
+		OptMaxHeaderBytes(1024),
+		OptShutdownTimeout(10 * time.Second),
+		OptShutdownDelay(time.Second),
+		OptOnShutdown(st.Close),
 		OptAutoCert("./ssl", "abc.fake.com"),
+		OptAutoCertDirectoryURL("https://127.0.0.1:14000/dir"),
+		OptAutoCertHTTPAddress("127.0.0.1:5002"),
+		OptTLS("./cert.pem", "./key.pem"),
+		OptTLSReloadInterval(time.Minute),
+		OptTLSMinVersion(tls.VersionTLS12),
+		OptTLSCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256),
+		OptTLSClientAuth(x509.NewCertPool(), tls.VerifyClientCertIfGiven),
 		OptStore(st),
+		OptJWTAuth(JWTAuthConfig{Algorithm: "HS256", Key: []byte("secret")}),
 		OptAddPingHandler(), OptAddPingHandler(), // for coverage
 		OptAddDebugHandler(), OptAddDebugHandler(), // for coverage
+		OptAdminAllowIPs("192.0.2.1"),
+		OptAddHealthHandler(),
+		OptLivenessCheck("live", time.Second, func(ctx context.Context) error { return nil }),
+		OptReadinessCheck("ready", time.Second, func(ctx context.Context) error { return nil }),
+		OptHealthCacheTTL(5 * time.Second),
+		OptMetrics(),
+		OptAccessLog(AccessLogConfig{Format: "json", Output: ioutil.Discard, ExcludePaths: []string{"/ping"}}),
 		OptAllowMethodOverride(), OptAllowMethodOverride(), // for coverage
 	}
 
@@ -39,14 +67,43 @@ func TestServerOptions(t *testing.T) {
 	// Test OptAddress
 	assert.Equal(t, "0.0.0.0:9876", s.address, "should be equal")
 
+	// Test OptReadTimeout, OptReadHeaderTimeout, OptWriteTimeout, OptIdleTimeout and OptMaxHeaderBytes
+	hs := s.newHTTPServer()
+	assert.Equal(t, time.Second, hs.ReadTimeout, "should be equal")
+	assert.Equal(t, 2*time.Second, hs.ReadHeaderTimeout, "should be equal")
+	assert.Equal(t, 3*time.Second, hs.WriteTimeout, "should be equal")
+	assert.Equal(t, 4*time.Second, hs.IdleTimeout, "should be equal")
+	assert.Equal(t, 1024, hs.MaxHeaderBytes, "should be equal")
+
+	// Test OptShutdownTimeout, OptShutdownDelay and OptOnShutdown
+	assert.Equal(t, 10*time.Second, s.shutdownTimeout, "should be equal")
+	assert.Equal(t, time.Second, s.shutdownDelay, "should be equal")
+	assert.Equal(t, 1, len(s.onShutdown), "should be equal")
+
 	// Test OptAutoCert
 	assert.Equal(t, true, s.enableAutoCert, "should be equal")
 	assert.Equal(t, "./ssl", s.autoCertCacheDirPath, "should be equal")
 	assert.Equal(t, []string{"abc.fake.com"}, s.autoCertDomains, "should be equal")
+	assert.Equal(t, "https://127.0.0.1:14000/dir", s.autoCertDirectoryURL, "should be equal")
+	assert.Equal(t, "127.0.0.1:5002", s.autoCertHTTPAddress, "should be equal")
+
+	// Test OptTLS, OptTLSReloadInterval, OptTLSMinVersion and OptTLSCipherSuites
+	assert.Equal(t, "./cert.pem", s.tlsCertFile, "should be equal")
+	assert.Equal(t, "./key.pem", s.tlsKeyFile, "should be equal")
+	assert.Equal(t, time.Minute, s.tlsReloadInterval, "should be equal")
+	assert.Equal(t, uint16(tls.VersionTLS12), s.tlsMinVersion, "should be equal")
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, s.tlsCipherSuites, "should be equal")
+
+	// Test OptTLSClientAuth
+	assert.NotNil(t, s.tlsClientCAs, "should not be nil")
+	assert.Equal(t, tls.VerifyClientCertIfGiven, s.tlsClientAuth, "should be equal")
 
 	// Test OptStore
 	assert.Equal(t, st, s.store, "should be equal")
 
+	// Test OptJWTAuth
+	assert.Equal(t, "HS256", s.jwtAuthConfig.Algorithm, "should be equal")
+
 	// Test OptAddPingHandler
 	status, respBody := sendRequestFunc(s.handler, "GET", "/ping", nil, nil)
 	assert.Equal(t, http.StatusOK, status, "should be equal")
@@ -58,6 +115,21 @@ func TestServerOptions(t *testing.T) {
 	status, respBody = sendRequestFunc(s.handler, "GET", "/debug/goroutine", nil, nil)
 	assert.Equal(t, http.StatusOK, status, "should be equal")
 
+	// Test OptAddHealthHandler, OptLivenessCheck, OptReadinessCheck and OptHealthCacheTTL
+	status, respBody = sendRequestFunc(s.handler, "GET", "/healthz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	status, respBody = sendRequestFunc(s.handler, "GET", "/readyz", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, 5*time.Second, s.healthCacheTTL, "should be equal")
+
+	// Test OptMetrics
+	status, respBody = sendRequestFunc(s.handler, "GET", "/metrics", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+
+	// Test OptAccessLog
+	assert.NotNil(t, s.accessLogger, "should not be nil")
+	assert.Equal(t, true, s.accessLogExcludes["/ping"], "should be equal")
+
 	// Test OptAllowMethodOverride
 	status, respBody = sendRequestFunc(s.handler, "GET", "/debug/pprof/symbol", H{"X-HTTP-Method-Override": "PATCH"}, nil)
 	assert.Equal(t, http.StatusNotFound, status, "should be equal")
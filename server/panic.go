@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PanicReport describes a panic recovered while dealing with a request.
+type PanicReport struct {
+	Time      time.Time `json:"time"`
+	Value     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	ClientIP  string    `json:"client_ip"`
+}
+
+// handlerPanic is a panic recovered in the goroutine of a handler and raised again in the
+// goroutine of the request, e.g. by the timeout middleware. It carries the stack of the
+// handler, which the recover middleware reports instead of its own.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// PanicReporter is notified of the panics recovered by server, e.g. to forward them to a
+// crash collector.
+type PanicReporter interface {
+	ReportPanic(report *PanicReport)
+}
+
+// PanicReporterFunc is a func which implements PanicReporter.
+type PanicReporterFunc func(report *PanicReport)
+
+// ReportPanic implements PanicReporter.
+func (f PanicReporterFunc) ReportPanic(report *PanicReport) {
+	f(report)
+}
+
+// FilePanicReporter appends panic reports to a file as JSON lines.
+type FilePanicReporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePanicReporter opens or creates the file which reports are appended to.
+func NewFilePanicReporter(path string) (*FilePanicReporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePanicReporter{file: file}, nil
+}
+
+// ReportPanic implements PanicReporter.
+func (r *FilePanicReporter) ReportPanic(report *PanicReport) {
+	b, err := json.Marshal(report)
+	if err != nil {
+		logger.Errorf("FilePanicReporter marshal report failed: %v", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.file.Write(append(b, '\n'))
+	if err != nil {
+		logger.Errorf("FilePanicReporter write report failed: %v", err)
+	}
+}
+
+// Close closes the file.
+func (r *FilePanicReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// reportPanic logs the report as a single Error entry and passes it to the reporters of
+// OptPanicReporter. A panicking reporter does not stop the others.
+func (s *Server) reportPanic(report *PanicReport) {
+	logger.WithFields(log.Fields{
+		"request_id": report.RequestID,
+		"panic":      report.Value,
+		"stack":      report.Stack,
+		"method":     report.Method,
+		"url":        report.URL,
+		"client_ip":  report.ClientIP,
+	}).Error("panic recovered")
+
+	for _, reporter := range s.panicReporters {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					logger.Errorf("PanicReporter %T panicked: %v", reporter, p)
+				}
+			}()
+			reporter.ReportPanic(report)
+		}()
+	}
+}
+
+// panicDetails is responded as the details of the error if OptExposePanicStack is set.
+func panicDetails(report *PanicReport) interface{} {
+	return map[string]interface{}{
+		"panic": report.Value,
+		"stack": strings.Split(strings.TrimSpace(report.Stack), "\n"),
+	}
+}
+
+// panicValue formats the value passed to panic.
+func panicValue(v interface{}) string {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(v)
+}
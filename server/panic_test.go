@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPanic(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	defer func(out io.Writer, formatter log.Formatter, level log.Level) {
+		log.SetOutput(out)
+		log.SetFormatter(formatter)
+		logging.SetLevel(level)
+	}(log.StandardLogger().Out, log.StandardLogger().Formatter, log.GetLevel())
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	log.SetFormatter(&log.JSONFormatter{})
+	logging.SetLevel(log.ErrorLevel)
+
+	reports := []*PanicReport{}
+	file := filepath.Join(t.TempDir(), "panics.log")
+	fileReporter, err := NewFilePanicReporter(file)
+	assert.Nil(t, err, "should be nil")
+	s := New("0.0.0.0:8888",
+		OptPanicReporter(PanicReporterFunc(func(report *PanicReport) { panic("reporter") })),
+		OptPanicReporter(PanicReporterFunc(func(report *PanicReport) { reports = append(reports, report) })),
+		OptPanicReporter(fileReporter),
+	)
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/panic", func(c *Context) { panic(errors.New("boom")) }},
+	})
+
+	// Test panic is logged, reported and responded
+	status, respBody := sendRequestFunc(s.handler, "GET", "/api/panic?q=1", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusInternalServerError, status, "should be equal")
+	assert.Equal(t, `{"error":{"code":"InternalServerError","msg":"Internal Server Error","request_id":"abc"}}`, respBody, "should be equal")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	entry := map[string]interface{}{}
+	err = json.Unmarshal([]byte(lines[0]), &entry)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "error", entry["level"], "should be equal")
+	assert.Equal(t, "panic recovered", entry["msg"], "should be equal")
+	assert.Equal(t, "boom", entry["panic"], "should be equal")
+	assert.Equal(t, "abc", entry["request_id"], "should be equal")
+	assert.Contains(t, entry["stack"], "panic_test.go", "should contain")
+	assert.Equal(t, 2, len(lines), "should be equal")
+	assert.Contains(t, lines[1], "panicked: reporter", "should contain")
+
+	assert.Equal(t, 1, len(reports), "should be equal")
+	assert.Equal(t, "boom", reports[0].Value, "should be equal")
+	assert.Equal(t, "GET", reports[0].Method, "should be equal")
+	assert.Equal(t, "/api/panic?q=1", reports[0].URL, "should be equal")
+	assert.Equal(t, "abc", reports[0].RequestID, "should be equal")
+
+	err = fileReporter.Close()
+	assert.Nil(t, err, "should be nil")
+	f, err := os.Open(file)
+	assert.Nil(t, err, "should be nil")
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	assert.Equal(t, true, scanner.Scan(), "should be true")
+	report := &PanicReport{}
+	err = json.Unmarshal(scanner.Bytes(), report)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "boom", report.Value, "should be equal")
+	assert.Contains(t, report.Stack, "panic_test.go", "should contain")
+
+	// Test stack is exposed
+	s = New("0.0.0.0:8888", OptExposePanicStack())
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/panic", func(c *Context) { panic("boom") }},
+	})
+	status, respBody = sendRequestFunc(s.handler, "GET", "/api/panic", nil, nil)
+	assert.Equal(t, http.StatusInternalServerError, status, "should be equal")
+	resp := struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Panic string   `json:"panic"`
+				Stack []string `json:"stack"`
+			} `json:"details"`
+		} `json:"error"`
+	}{}
+	err = json.Unmarshal([]byte(respBody), &resp)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "InternalServerError", resp.Error.Code, "should be equal")
+	assert.Equal(t, "boom", resp.Error.Details.Panic, "should be equal")
+	assert.Contains(t, strings.Join(resp.Error.Details.Stack, "\n"), "panic_test.go", "should contain")
+}
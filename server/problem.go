@@ -0,0 +1,117 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorFormat is the format of error responses.
+type ErrorFormat string
+
+const (
+	// ErrorFormatEnvelope responds {"error":{"code":...,"msg":...}}. It is default.
+	ErrorFormatEnvelope ErrorFormat = "envelope"
+	// ErrorFormatProblem responds RFC 7807 application/problem+json.
+	ErrorFormatProblem ErrorFormat = "problem"
+	// ErrorFormatNegotiate responds application/problem+json if the Accept header of the
+	// request prefers it to application/json, otherwise the envelope.
+	ErrorFormatNegotiate ErrorFormat = "negotiate"
+)
+
+// MIMEProblemJSON is the content type of RFC 7807 problem details.
+const MIMEProblemJSON = "application/problem+json"
+
+const (
+	contextKeyErrorFormat        = "errorFormat"
+	contextKeyProblemTypeBaseURI = "problemTypeBaseURI"
+)
+
+// problem is the RFC 7807 problem details with the members of the envelope as extensions.
+type problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// errorFormat is the default middleware which passes the settings of OptErrorFormat to
+// errResp through Context, so the resp helpers keep their signatures. It does nothing
+// unless OptErrorFormat is set.
+func (s *Server) errorFormat() HandlerFunc {
+	return func(c *Context) {
+		if s.errFormat != "" && s.errFormat != ErrorFormatEnvelope {
+			c.Set(contextKeyErrorFormat, s.errFormat)
+			c.Set(contextKeyProblemTypeBaseURI, s.problemTypeBaseURI)
+		}
+		c.Next()
+	}
+}
+
+// respondsProblem reports whether the error of the request is responded as problem+json.
+func respondsProblem(c *Context) bool {
+	v, _ := c.Get(contextKeyErrorFormat)
+	switch v {
+	case ErrorFormatProblem:
+		return true
+	case ErrorFormatNegotiate:
+		return prefersProblem(c.GetHeader("Accept"))
+	}
+	return false
+}
+
+// prefersProblem reports whether the Accept header gives application/problem+json a
+// positive quality which is not lower than the one of application/json.
+func prefersProblem(accept string) bool {
+	problemQ, jsonQ := -1.0, -1.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case MIMEProblemJSON:
+			problemQ = q
+		case "application/json":
+			jsonQ = q
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
+
+// problemResp responds the error as RFC 7807 problem details. The type is the code
+// under the base URI of OptProblemTypeBaseURI, or about:blank if it is not set.
+func problemResp(c *Context, status int, code, msg string, details interface{}) {
+	p := &problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    msg,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		Details:   details,
+		RequestID: RequestID(c),
+	}
+	if baseURI := c.GetString(contextKeyProblemTypeBaseURI); baseURI != "" {
+		p.Type = strings.TrimSuffix(baseURI, "/") + "/" + code
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, MIMEProblemJSON, b)
+}
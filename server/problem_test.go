@@ -0,0 +1,84 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblem(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	var newServerFunc = func(opts ...Option) *Server {
+		s := New("0.0.0.0:8888", opts...)
+		s.addRoutes("/api", nil, []route{
+			{"GET", "/users/:id", func(c *Context) { NotFoundResp(c, "user is not found") }},
+			{"GET", "/conflict", func(c *Context) {
+				c.Error(NewAPIError(http.StatusConflict, "Conflict", "").WithDetails(H{"name": "taken"}).WithCause(store.ErrDuplicate))
+			}},
+		})
+		return s
+	}
+
+	// Test problem format
+	s := newServerFunc(OptErrorFormat(ErrorFormatProblem))
+	status, header, respBody := sendRequestFunc(s.handler, "GET", "/api/users/1", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+	assert.Equal(t, "application/problem+json", header.Get("Content-Type"), "should be equal")
+	assert.Equal(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"user is not found","instance":"/api/users/1","code":"NotFound","request_id":"abc"}`, respBody, "should be equal")
+
+	status, _, respBody = sendRequestFunc(s.handler, "GET", "/api/conflict", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusConflict, status, "should be equal")
+	assert.Equal(t, `{"type":"about:blank","title":"Conflict","status":409,"detail":"Conflict","instance":"/api/conflict","code":"Conflict","details":{"name":"taken"},"request_id":"abc"}`, respBody, "should be equal")
+
+	// Test unmatched route
+	status, header, _ = sendRequestFunc(s.handler, "GET", "/nothing", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+	assert.Equal(t, "application/problem+json", header.Get("Content-Type"), "should be equal")
+
+	// Test type base URI
+	s = newServerFunc(OptErrorFormat(ErrorFormatProblem), OptProblemTypeBaseURI("https://example.com/problems/"))
+	_, _, respBody = sendRequestFunc(s.handler, "GET", "/api/users/1", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, `{"type":"https://example.com/problems/NotFound","title":"Not Found","status":404,"detail":"user is not found","instance":"/api/users/1","code":"NotFound","request_id":"abc"}`, respBody, "should be equal")
+
+	// Test negotiation
+	s = newServerFunc(OptErrorFormat(ErrorFormatNegotiate))
+	type testCase struct {
+		Accept              string
+		ExpectedContentType string
+	}
+	testCases := []testCase{
+		{"", "application/json; charset=utf-8"},
+		{"application/json", "application/json; charset=utf-8"},
+		{"*/*", "application/json; charset=utf-8"},
+		{"application/problem+json", "application/problem+json"},
+		{"application/json, application/problem+json", "application/problem+json"},
+		{"application/json, application/problem+json;q=0.5", "application/json; charset=utf-8"},
+		{"application/json;q=0.5, application/problem+json;q=0.9", "application/problem+json"},
+		{"application/problem+json;q=0", "application/json; charset=utf-8"},
+	}
+	for _, c := range testCases {
+		status, header, _ = sendRequestFunc(s.handler, "GET", "/api/users/1", H{"Accept": c.Accept}, nil)
+		assert.Equal(t, http.StatusNotFound, status, "should be equal")
+		assert.Equal(t, c.ExpectedContentType, header.Get("Content-Type"), "should be equal")
+	}
+
+	// Test default envelope
+	s = newServerFunc(OptErrorFormat(ErrorFormat("xml")))
+	_, _, respBody = sendRequestFunc(s.handler, "GET", "/api/users/1", H{"Accept": "application/problem+json", "X-Request-ID": "abc"}, nil)
+	assert.Equal(t, `{"error":{"code":"NotFound","msg":"user is not found","request_id":"abc"}}`, respBody, "should be equal")
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+)
+
+// RateLimitKeyFunc returns the key of the bucket which the request takes a token from.
+// The request is not limited if it returns an empty string.
+type RateLimitKeyFunc func(c *Context) string
+
+// RateLimitByIP keys requests by c.ClientIP().
+func RateLimitByIP() RateLimitKeyFunc {
+	return func(c *Context) string {
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// RateLimitByHeader keys requests by the value of a header, e.g. X-API-Key.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(c *Context) string {
+		v := c.GetHeader(name)
+		if v == "" {
+			return ""
+		}
+		return "header:" + name + ":" + v
+	}
+}
+
+// RateLimitByJWTClaim keys requests by a claim of the JWT, e.g. sub. It must be used
+// after the jwtAuth middleware.
+func RateLimitByJWTClaim(claim string) RateLimitKeyFunc {
+	return func(c *Context) string {
+		claims, ok := JWTClaims(c)
+		if !ok {
+			return ""
+		}
+		v, ok := claims[claim]
+		if !ok {
+			return ""
+		}
+		return "jwt:" + claim + ":" + fmt.Sprint(v)
+	}
+}
+
+// RateLimitConfig contains the settings of a token bucket rate limiter.
+type RateLimitConfig struct {
+	// Limit is how many requests a key can make in Period.
+	Limit int
+	// Period is the time in which the bucket is refilled with Limit tokens.
+	Period time.Duration
+	// Burst is the size of the bucket. Default is Limit.
+	Burst int
+	// Key extracts the key of the bucket. Default is RateLimitByIP.
+	Key RateLimitKeyFunc
+	// Name separates the buckets of limiters in the shared store. Default is "default".
+	Name string
+	// Shared keeps buckets in the store of OptStore if it implements store.RateLimiter,
+	// so instances share the limits. The in-memory buckets are used if the store fails.
+	Shared bool
+	// MaxKeys caps the in-memory buckets, so clients rotating keys can not exhaust the
+	// memory. The least recently used bucket is evicted beyond it. Default is 100000.
+	MaxKeys int
+}
+
+// defaultRateLimitMaxKeys is the default of RateLimitConfig.MaxKeys.
+const defaultRateLimitMaxKeys = 100000
+
+// rateLimiter is a token bucket rate limiter built from RateLimitConfig.
+type rateLimiter struct {
+	cfg   RateLimitConfig
+	rate  float64
+	burst int
+
+	// buckets indexes the elements of order, which holds the buckets from the most
+	// recently used to the least.
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	order   *list.List
+}
+
+// tokenBucket is the bucket of a key.
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter returns a rateLimiter. It returns error if cfg is invalid.
+func newRateLimiter(cfg RateLimitConfig) (*rateLimiter, error) {
+	if cfg.Limit <= 0 || cfg.Period <= 0 {
+		return nil, errors.New("limit and period of rate limit must be positive")
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Limit
+	}
+	if cfg.Key == nil {
+		cfg.Key = RateLimitByIP()
+	}
+	if cfg.Name == "" {
+		cfg.Name = "default"
+	}
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = defaultRateLimitMaxKeys
+	}
+	return &rateLimiter{
+		cfg:     cfg,
+		rate:    float64(cfg.Limit) / cfg.Period.Seconds(),
+		burst:   cfg.Burst,
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}, nil
+}
+
+// take takes a token from the in-memory bucket of key. It returns the tokens left and
+// whether a token is taken.
+func (l *rateLimiter) take(key string, now time.Time) (float64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	var b *tokenBucket
+	if e, ok := l.buckets[key]; ok {
+		l.order.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+	} else {
+		if l.order.Len() >= l.cfg.MaxKeys {
+			l.remove(l.order.Back())
+		}
+		b = &tokenBucket{key: key, tokens: float64(l.burst), updated: now}
+		l.buckets[key] = l.order.PushFront(b)
+	}
+	if now.After(b.updated) {
+		b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		return b.tokens, false
+	}
+	b.tokens--
+	return b.tokens, true
+}
+
+// inherit copies the in-memory buckets of old, capped by the burst and the max keys of l,
+// so replacing a limiter does not reset the limits of clients.
+func (l *rateLimiter) inherit(old *rateLimiter) {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for e := old.order.Front(); e != nil && l.order.Len() < l.cfg.MaxKeys; e = e.Next() {
+		b := e.Value.(*tokenBucket)
+		l.buckets[b.key] = l.order.PushBack(&tokenBucket{key: b.key, tokens: math.Min(b.tokens, float64(l.burst)), updated: b.updated})
+	}
+}
+
+// sweep evicts the buckets which have been refilled to full, since they are the same as
+// new ones. They are the least recently used ones, so it stops at the first bucket which
+// is not full.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+	for e := l.order.Back(); e != nil && now.Sub(e.Value.(*tokenBucket).updated) >= refill; e = l.order.Back() {
+		l.remove(e)
+	}
+}
+
+// remove evicts the bucket of e.
+func (l *rateLimiter) remove(e *list.Element) {
+	l.order.Remove(e)
+	delete(l.buckets, e.Value.(*tokenBucket).key)
+}
+
+// rateLimit returns the middleware which limits requests by cfg. It can be attached to
+// the routes groups in addRoutes, e.g. after s.jwtAuth() to limit by JWT claims. It
+// panics if cfg is invalid.
+func (s *Server) rateLimit(cfg RateLimitConfig) HandlerFunc {
+	l, err := newRateLimiter(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *Context) {
+		s.limit(c, l)
+	}
+}
+
+// defaultRateLimit is the default middleware which limits all requests by the config of
+// OptRateLimit or Reload. It does nothing unless either sets it.
+func (s *Server) defaultRateLimit() HandlerFunc {
+	return func(c *Context) {
+		s.reloadMu.RLock()
+		l := s.rateLimiter
+		s.reloadMu.RUnlock()
+		if l == nil {
+			c.Next()
+			return
+		}
+		s.limit(c, l)
+	}
+}
+
+// limit takes a token for the request and sets the RateLimit headers, or responds
+// TooManyRequests with Retry-After if there is no token.
+func (s *Server) limit(c *Context, l *rateLimiter) {
+	key := l.cfg.Key(c)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	remaining, ok := 0.0, false
+	shared := false
+	if rl, isRateLimiter := s.store.(store.RateLimiter); l.cfg.Shared && isRateLimiter {
+		var err error
+		remaining, ok, err = rl.TakeToken(l.cfg.Name+":"+key, l.rate, l.burst)
+		if err != nil {
+			s.observeStoreError(err)
+			logger.Warnf("shared rate limit failed, fall back to in-memory buckets: %v", err)
+		} else {
+			shared = true
+		}
+	}
+	if !shared {
+		remaining, ok = l.take(key, time.Now())
+	}
+
+	header := c.Writer.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(l.burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(l.burst)-remaining)/l.rate))))
+	if !ok {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil((1-remaining)/l.rate))))
+		s.tooManyRequestsResp(c, fmt.Errorf("rate limit of %s exceeded", key), "")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
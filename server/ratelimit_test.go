@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/mikunalpha/httpsrvtpl/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// rateLimitStore is a store.Store and store.RateLimiter which records the keys taken.
+type rateLimitStore struct {
+	mu   sync.Mutex
+	keys []string
+	ok   bool
+	err  error
+}
+
+func (s *rateLimitStore) Ping(ctx context.Context) error { return nil }
+
+func (s *rateLimitStore) Close() {}
+
+func (s *rateLimitStore) TakeToken(key string, rate float64, burst int) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	return 0.5, s.ok, s.err
+}
+
+func TestRateLimit(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	// Test default limit by IP
+	s := New("0.0.0.0:8888", OptRateLimit(RateLimitConfig{Limit: 2, Period: time.Second}))
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/items", func(c *Context) { c.String(http.StatusOK, "items") }},
+	})
+	status, header, _ := sendRequestFunc(s.handler, "GET", "/api/items", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "2", header.Get("RateLimit-Limit"), "should be equal")
+	assert.Equal(t, "1", header.Get("RateLimit-Remaining"), "should be equal")
+	assert.Equal(t, "1", header.Get("RateLimit-Reset"), "should be equal")
+	status, header, _ = sendRequestFunc(s.handler, "GET", "/api/items", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "0", header.Get("RateLimit-Remaining"), "should be equal")
+	status, header, respBody := sendRequestFunc(s.handler, "GET", "/api/items", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusTooManyRequests, status, "should be equal")
+	assert.Equal(t, "1", header.Get("Retry-After"), "should be equal")
+	assert.Equal(t, `{"error":{"code":"TooManyRequests","msg":"Too Many Requests","request_id":"abc"}}`, respBody, "should be equal")
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/api/items", H{"X-Forwarded-For": "10.0.0.1"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	time.Sleep(600 * time.Millisecond)
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/api/items", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+
+	// Test eviction of full buckets
+	l, err := newRateLimiter(RateLimitConfig{Limit: 10, Period: time.Second})
+	assert.Nil(t, err, "should be nil")
+	now := time.Now()
+	l.take("a", now)
+	l.take("b", now.Add(500*time.Millisecond))
+	l.take("c", now.Add(1100*time.Millisecond))
+	assert.Equal(t, 2, len(l.buckets), "should be equal")
+	_, ok := l.buckets["a"]
+	assert.Equal(t, false, ok, "should be false")
+
+	// Test the buckets are capped by MaxKeys, and the least recently used one is evicted
+	l, err = newRateLimiter(RateLimitConfig{Limit: 1, Period: time.Hour, MaxKeys: 3})
+	assert.Nil(t, err, "should be nil")
+	l.take("a", now)
+	l.take("b", now)
+	l.take("c", now)
+	l.take("a", now)
+	for i := 0; i < 100; i++ {
+		l.take(fmt.Sprint("rotated", i), now)
+	}
+	assert.Equal(t, 3, len(l.buckets), "should be equal")
+	assert.Equal(t, 3, l.order.Len(), "should be equal")
+	l.take("d", now)
+	_, ok = l.buckets["rotated97"]
+	assert.Equal(t, false, ok, "should be false")
+	_, ok = l.buckets["rotated99"]
+	assert.Equal(t, true, ok, "should be true")
+	_, ok = l.buckets["d"]
+	assert.Equal(t, true, ok, "should be true")
+
+	// Test group limit by header and JWT claim
+	secret := []byte("secret")
+	s = New("0.0.0.0:8888", OptJWTAuth(JWTAuthConfig{Algorithm: "HS256", Key: secret}))
+	s.addRoutes("/keys", []HandlerFunc{s.rateLimit(RateLimitConfig{Limit: 1, Period: time.Minute, Key: RateLimitByHeader("X-API-Key")})}, []route{
+		{"GET", "/items", func(c *Context) { c.String(http.StatusOK, "items") }},
+	})
+	s.addRoutes("/users", []HandlerFunc{s.jwtAuth(), s.rateLimit(RateLimitConfig{Limit: 1, Period: time.Minute, Key: RateLimitByJWTClaim("sub")})}, []route{
+		{"GET", "/me", func(c *Context) { c.String(http.StatusOK, "me") }},
+	})
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/keys/items", H{"X-API-Key": "a"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/keys/items", H{"X-API-Key": "a"}, nil)
+	assert.Equal(t, http.StatusTooManyRequests, status, "should be equal")
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/keys/items", H{"X-API-Key": "b"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	status, header, _ = sendRequestFunc(s.handler, "GET", "/keys/items", nil, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "", header.Get("RateLimit-Limit"), "should be equal")
+
+	var tokenFunc = func(sub string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub}).SignedString(secret)
+		return "Bearer " + token
+	}
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/users/me", H{"Authorization": tokenFunc("mikun")}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	status, header, _ = sendRequestFunc(s.handler, "GET", "/users/me", H{"Authorization": tokenFunc("mikun")}, nil)
+	assert.Equal(t, http.StatusTooManyRequests, status, "should be equal")
+	assert.Equal(t, "60", header.Get("Retry-After"), "should be equal")
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/users/me", H{"Authorization": tokenFunc("other")}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+
+	// Test shared limit by store
+	st := &rateLimitStore{ok: false}
+	s = New("0.0.0.0:8888", OptStore(st), OptRateLimit(RateLimitConfig{Limit: 2, Period: time.Second, Name: "api", Shared: true}))
+	status, header, _ = sendRequestFunc(s.handler, "GET", "/nothing", nil, nil)
+	assert.Equal(t, http.StatusTooManyRequests, status, "should be equal")
+	assert.Equal(t, "1", header.Get("Retry-After"), "should be equal")
+	assert.Equal(t, []string{"api:ip:192.0.2.1"}, st.keys, "should be equal")
+
+	// Test fall back to in-memory buckets if store fails
+	st.err = store.ErrConnectionFailed
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/nothing", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+	assert.Equal(t, 2, len(st.keys), "should be equal")
+
+	// Test invalid config
+	s = New("0.0.0.0:8888", OptRateLimit(RateLimitConfig{Limit: 1}))
+	assert.Nil(t, s.rateLimiter, "should be nil")
+	assert.Panics(t, func() { s.rateLimit(RateLimitConfig{Period: time.Second}) }, "should panic")
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ReloadConfig contains the settings which Reload applies to a running server.
+type ReloadConfig struct {
+	// CORS replaces the default CORS policy of OptCORS. Nil disables it. The policies of
+	// OptCORSPrefix are kept.
+	CORS *CORSConfig
+	// RateLimit replaces the default rate limit of OptRateLimit. Nil disables it. The
+	// tokens left in the in-memory buckets are kept.
+	RateLimit *RateLimitConfig
+}
+
+// Reload applies cfg to the server, and reloads the certificate of OptTLS if the server
+// is running with it. Nothing is changed if any of them is invalid, so the server keeps
+// the old settings. Listeners, established connections and in-flight requests are not
+// affected.
+func (s *Server) Reload(cfg ReloadConfig) error {
+	var policy *corsPolicy
+	if cfg.CORS != nil {
+		p, err := newCORSPolicy(*cfg.CORS)
+		if err != nil {
+			return fmt.Errorf("reload CORS failed: %v", err)
+		}
+		policy = p
+	}
+
+	var limiter *rateLimiter
+	if cfg.RateLimit != nil {
+		l, err := newRateLimiter(*cfg.RateLimit)
+		if err != nil {
+			return fmt.Errorf("reload rate limit failed: %v", err)
+		}
+		limiter = l
+	}
+
+	s.mu.Lock()
+	reloader := s.certReloader
+	s.mu.Unlock()
+	var cert *loadedCert
+	if reloader != nil {
+		lc, err := reloader.load()
+		if err != nil {
+			return fmt.Errorf("reload certificate failed: %v", err)
+		}
+		cert = lc
+	}
+
+	s.reloadMu.Lock()
+	if limiter != nil && s.rateLimiter != nil {
+		limiter.inherit(s.rateLimiter)
+	}
+	s.corsPolicy = policy
+	s.rateLimiter = limiter
+	s.reloadMu.Unlock()
+	if cert != nil {
+		reloader.set(cert)
+	}
+	return nil
+}
+
+// reloadHandler calls reload, and responds InvalidParameter with the error if it fails.
+func (s *Server) reloadHandler(reload func() error) HandlerFunc {
+	return func(c *Context) {
+		err := reload()
+		if err != nil {
+			s.invalidParameterResp(c, err, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, &struct {
+			Reload string `json:"reload"`
+		}{"ok"})
+	}
+}
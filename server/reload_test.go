@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	s := New("0.0.0.0:8888",
+		OptCORS(CORSConfig{AllowOrigins: []string{"https://a.com"}}),
+		OptRateLimit(RateLimitConfig{Limit: 2, Period: time.Hour}),
+	)
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/items", func(c *Context) { c.String(http.StatusOK, "items") }},
+	})
+
+	_, header, _ := sendRequestFunc(s.handler, "GET", "/api/items", H{"Origin": "https://a.com"}, nil)
+	assert.Equal(t, "https://a.com", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "1", header.Get("RateLimit-Remaining"), "should be equal")
+
+	// Test CORS and rate limit are replaced, and tokens left are kept
+	err := s.Reload(ReloadConfig{
+		CORS:      &CORSConfig{AllowOrigins: []string{"https://b.com"}},
+		RateLimit: &RateLimitConfig{Limit: 5, Period: time.Hour},
+	})
+	assert.Nil(t, err, "should be nil")
+	_, header, _ = sendRequestFunc(s.handler, "GET", "/api/items", H{"Origin": "https://a.com"}, nil)
+	assert.Equal(t, "", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "5", header.Get("RateLimit-Limit"), "should be equal")
+	assert.Equal(t, "0", header.Get("RateLimit-Remaining"), "should be equal")
+	_, header, _ = sendRequestFunc(s.handler, "GET", "/api/items", H{"Origin": "https://b.com", "X-Forwarded-For": "10.0.0.1"}, nil)
+	assert.Equal(t, "https://b.com", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "4", header.Get("RateLimit-Remaining"), "should be equal")
+
+	// Test invalid config keeps the old settings
+	err = s.Reload(ReloadConfig{
+		CORS:      &CORSConfig{AllowOrigins: []string{"https://*.*.com"}},
+		RateLimit: &RateLimitConfig{Limit: 1, Period: time.Hour},
+	})
+	assert.NotNil(t, err, "should not be nil")
+	err = s.Reload(ReloadConfig{
+		CORS:      &CORSConfig{AllowOrigins: []string{"https://c.com"}},
+		RateLimit: &RateLimitConfig{Limit: 1},
+	})
+	assert.NotNil(t, err, "should not be nil")
+	_, header, _ = sendRequestFunc(s.handler, "GET", "/api/items", H{"Origin": "https://b.com"}, nil)
+	assert.Equal(t, "https://b.com", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "5", header.Get("RateLimit-Limit"), "should be equal")
+
+	// Test nil disables them
+	err = s.Reload(ReloadConfig{})
+	assert.Nil(t, err, "should be nil")
+	status, header, _ := sendRequestFunc(s.handler, "GET", "/api/items", H{"Origin": "https://b.com"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "", header.Get("Access-Control-Allow-Origin"), "should be equal")
+	assert.Equal(t, "", header.Get("RateLimit-Limit"), "should be equal")
+
+	// Test reload handler
+	reloadErr := errors.New("invalid config: address is empty")
+	s = New("0.0.0.0:8888", OptAdminToken("secret"), OptAddReloadHandler(func() error { return reloadErr }))
+	status, _, respBody := sendRequestFunc(s.handler, "POST", "/admin/reload", H{"Authorization": "Bearer secret", "X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status, "should be equal")
+	assert.Equal(t, `{"error":{"code":"InvalidParameter","msg":"invalid config: address is empty","request_id":"abc"}}`, respBody, "should be equal")
+	reloadErr = nil
+	status, _, respBody = sendRequestFunc(s.handler, "POST", "/admin/reload", H{"Authorization": "Bearer secret"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, `{"reload":"ok"}`, respBody, "should be equal")
+}
+
+func TestReloadWithTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertFiles(t, certFile, keyFile, "first", time.Now().Add(time.Hour))
+
+	var peerCNFunc = func(addr string) string {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return ""
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	s := New("127.0.0.1:0", OptTLS(certFile, keyFile), OptTLSReloadInterval(0))
+	err := s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	defer s.Stop()
+
+	// Test broken certificate keeps the old settings
+	os.WriteFile(keyFile, []byte("broken"), 0600)
+	err = s.Reload(ReloadConfig{CORS: &CORSConfig{AllowOrigins: []string{"*"}}})
+	assert.NotNil(t, err, "should not be nil")
+	assert.Nil(t, s.corsPolicy, "should be nil")
+	assert.Equal(t, "first", peerCNFunc(s.Addr().String()), "should be equal")
+
+	// Test certificate is reloaded with the others
+	writeCertFiles(t, certFile, keyFile, "second", time.Now().Add(time.Hour))
+	err = s.Reload(ReloadConfig{CORS: &CORSConfig{AllowOrigins: []string{"*"}}})
+	assert.Nil(t, err, "should be nil")
+	assert.NotNil(t, s.corsPolicy, "should not be nil")
+	assert.Equal(t, "second", peerCNFunc(s.Addr().String()), "should be equal")
+}
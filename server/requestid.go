@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	// HeaderRequestID is the header carrying the request ID.
+	HeaderRequestID = "X-Request-ID"
+	// ContextKeyRequestID is the key of the request ID stored in Context.
+	ContextKeyRequestID = "requestID"
+)
+
+// RequestID returns the request ID stored in Context by the requestID middleware.
+func RequestID(c *Context) string {
+	return c.GetString(ContextKeyRequestID)
+}
+
+// requestID is the default middleware which accepts the X-Request-ID of a request, or
+// generates one if it is absent or invalid. The ID is echoed in the response header.
+func (s *Server) requestID() HandlerFunc {
+	return func(c *Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(ContextKeyRequestID, id)
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// validRequestID reports whether id is short and only contains printable ASCII, so it
+// is safe to put into logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128 bits ID in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
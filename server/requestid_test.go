@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	s := New("0.0.0.0:8888")
+	s.addRoutes("/api", nil, []route{
+		{"GET", "/id", func(c *Context) { c.String(http.StatusOK, RequestID(c)) }},
+		{"GET", "/notfound", func(c *Context) { s.notFoundResp(c, nil, "") }},
+	})
+
+	// Test incoming ID is accepted and echoed
+	status, header, respBody := sendRequestFunc(s.handler, "GET", "/api/id", H{"X-Request-ID": "req-123"}, nil)
+	assert.Equal(t, http.StatusOK, status, "should be equal")
+	assert.Equal(t, "req-123", respBody, "should be equal")
+	assert.Equal(t, "req-123", header.Get("X-Request-ID"), "should be equal")
+
+	// Test ID is generated if absent
+	hexID := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	_, header, respBody = sendRequestFunc(s.handler, "GET", "/api/id", nil, nil)
+	assert.Equal(t, true, hexID.MatchString(respBody), "should be true")
+	assert.Equal(t, respBody, header.Get("X-Request-ID"), "should be equal")
+	_, _, another := sendRequestFunc(s.handler, "GET", "/api/id", nil, nil)
+	assert.NotEqual(t, respBody, another, "should not be equal")
+
+	// Test invalid ID is replaced
+	for _, id := range []string{strings.Repeat("a", 129), "a b", "ä"} {
+		_, header, respBody = sendRequestFunc(s.handler, "GET", "/api/id", H{"X-Request-ID": id}, nil)
+		assert.Equal(t, true, hexID.MatchString(respBody), "should be true")
+		assert.Equal(t, respBody, header.Get("X-Request-ID"), "should be equal")
+	}
+
+	// Test ID is in error response and log
+	defer func(out io.Writer, level log.Level) {
+		log.SetOutput(out)
+		logging.SetLevel(level)
+	}(log.StandardLogger().Out, log.GetLevel())
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	logging.SetLevel(log.DebugLevel)
+	status, header, respBody = sendRequestFunc(s.handler, "GET", "/api/notfound", H{"X-Request-ID": "req-456"}, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+	assert.Equal(t, "req-456", header.Get("X-Request-ID"), "should be equal")
+	assert.Equal(t, `{"error":{"code":"NotFound","msg":"Not Found","request_id":"req-456"}}`, respBody, "should be equal")
+	assert.Contains(t, out.String(), "request_id=req-456", "should contain")
+
+	// Test ID is set for unmatched routes
+	status, header, respBody = sendRequestFunc(s.handler, "GET", "/api/nothing", H{"X-Request-ID": "req-789"}, nil)
+	assert.Equal(t, http.StatusNotFound, status, "should be equal")
+	assert.Equal(t, "req-789", header.Get("X-Request-ID"), "should be equal")
+}
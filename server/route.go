@@ -4,4 +4,21 @@ func (s *Server) setRoutes() {
 	// s.addRoutes("/", []HandlerFunc{}, []route{
 	// 	{"GET", "", func(c *Context) { c.String(http.StatusOK, "") }},
 	// })
+	//
+	// s.addRoutes("/api/v1", []HandlerFunc{s.timeout(5 * time.Second), s.jwtAuth()}, []route{
+	// 	{"GET", "/me", func(c *Context) { claims, _ := JWTClaims(c); c.JSON(http.StatusOK, claims) }},
+	// })
+	//
+	// Use OptCORSPrefix("/public", CORSConfig{...}) to apply a different CORS policy to a group
+	// s.addRoutes("/public", []HandlerFunc{}, []route{
+	// 	{"GET", "/items", func(c *Context) { c.JSON(http.StatusOK, []string{}) }},
+	// })
+	//
+	// s.addRoutes("/api/v2", []HandlerFunc{s.jwtAuth(), s.rateLimit(RateLimitConfig{Limit: 100, Period: time.Minute, Key: RateLimitByJWTClaim("sub")})}, []route{
+	// 	{"GET", "/me", func(c *Context) { claims, _ := JWTClaims(c); c.JSON(http.StatusOK, claims) }},
+	// })
+	//
+	// s.addRoutes("/internal", []HandlerFunc{s.clientCertAuth()}, []route{
+	// 	{"GET", "/whoami", func(c *Context) { id, _ := ClientIdentityFromContext(c); c.JSON(http.StatusOK, id) }},
+	// })
 }
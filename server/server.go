@@ -3,22 +3,32 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"runtime"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/mikunalpha/httpsrvtpl/logging"
 	"github.com/mikunalpha/httpsrvtpl/store"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 )
 
 // Use jsoniter as default json package.
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// logger is the logger of the server component, its level can be overridden by PUT
+// /debug/loglevel.
+var logger = logging.Component(logging.ComponentServer)
+
 type (
 	// HandlerFunc is alias of gin.HandlerFunc.
 	HandlerFunc = gin.HandlerFunc
@@ -28,14 +38,25 @@ type (
 
 func init() {
 	gin.SetMode(gin.ReleaseMode)
+	// Binding does not validate, BindAndValidate does it with field errors instead
 	gin.DisableBindValidation()
 }
 
 // New accepts a address and some opts, then it returns a new Server.
 func New(address string, opts ...Option) *Server {
 	s := &Server{
-		address:      address,
-		routerEngine: gin.New(),
+		address:             address,
+		routerEngine:        gin.New(),
+		readTimeout:         10 * time.Second,
+		writeTimeout:        30 * time.Second,
+		idleTimeout:         120 * time.Second,
+		autoCertHTTPAddress: ":80",
+		tlsReloadInterval:   10 * time.Second,
+		shutdownTimeout:     5 * time.Second,
+		conns:               make(map[net.Conn]http.ConnState),
+		done:                make(chan struct{}),
+		healthCacheTTL:      time.Second,
+		healthCache:         &healthCache{results: make(map[string]*healthResult)},
 	}
 	s.handler = s.routerEngine
 
@@ -43,7 +64,7 @@ func New(address string, opts ...Option) *Server {
 	s.routerEngine.NoRoute(func(c *Context) {
 		s.notFoundResp(c, fmt.Errorf("request not found [%s] %s", c.Request.Method, c.Request.URL), "")
 	})
-	s.routerEngine.Use(s.recover())
+	s.routerEngine.Use(s.requestID(), s.errorFormat(), s.localize(), s.accessLog(), s.instrument(), s.recover(), s.cors(), s.defaultRateLimit(), s.renderError())
 
 	// Set up the opts
 	for _, opt := range opts {
@@ -52,49 +73,133 @@ func New(address string, opts ...Option) *Server {
 
 	// Set routes
 	s.setRoutes()
+	s.setAdminRoutes()
 
 	return s
 }
 
 // Server is responsible for supplying HTTP service.
 type Server struct {
+	// stopMu serializes Run and Stop, so Run waits for a Stop in progress. Stop does not
+	// hold mu while draining, since in-flight handlers may lock it, e.g. Reload.
+	stopMu  sync.Mutex
 	mu      sync.Mutex
 	running bool
 
-	address      string
-	routerEngine *gin.Engine
-	handler      http.Handler
-	server       *http.Server
+	address         string
+	listenAddresses []string
+	routerEngine    *gin.Engine
+	handler         http.Handler
+	server          *http.Server
+	listeners       []net.Listener
+	done            chan struct{}
+	err             error
+
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	onShutdown      []func()
+	draining        int32
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]http.ConnState
 
 	enableAutoCert       bool
 	autoCertCacheDirPath string
 	autoCertDomains      []string
+	autoCertDirectoryURL string
+	autoCertHTTPAddress  string
+	challengeServer      *http.Server
+	challengeListener    net.Listener
+
+	tlsCertFile       string
+	tlsKeyFile        string
+	tlsMinVersion     uint16
+	tlsCipherSuites   []uint16
+	tlsClientCAs      *x509.CertPool
+	tlsClientAuth     tls.ClientAuthType
+	tlsReloadInterval time.Duration
+	certReloader      *certReloader
 
 	store store.Store
 
+	livenessChecks  []healthCheck
+	readinessChecks []healthCheck
+	healthCacheTTL  time.Duration
+	healthCache     *healthCache
+
+	jwtAuthConfig *JWTAuthConfig
+
 	hasAllowMethodOverride bool
 	hasPingHandler         bool
 	hasDebugHandler        bool
+	hasHealthHandler       bool
+
+	metrics *metrics
+
+	accessLogger      *log.Logger
+	accessLogConfig   AccessLogConfig
+	accessLogExcludes map[string]bool
+
+	errFormat          ErrorFormat
+	problemTypeBaseURI string
+
+	messageCatalog *MessageCatalog
+
+	panicReporters   []PanicReporter
+	exposePanicStack bool
+
+	// reloadMu guards the settings replaced by Reload
+	reloadMu           sync.RWMutex
+	corsPolicy         *corsPolicy
+	corsPrefixPolicies []prefixCORSPolicy
+
+	rateLimiter *rateLimiter
+
+	adminAddress   string
+	adminEngine    *gin.Engine
+	adminServer    *http.Server
+	adminListener  net.Listener
+	adminToken     string
+	adminUsername  string
+	adminPassword  string
+	adminAllowNets []*net.IPNet
+	reload         func() error
 }
 
-// recover is the default middleware used to deal with panic.
+// recover is the default middleware used to deal with panic. The panic is logged with
+// its stack and reported to the reporters of OptPanicReporter, then an
+// InternalServerError is responded, with the stack if OptExposePanicStack is set.
 func (s *Server) recover() HandlerFunc {
 	return func(c *Context) {
 		defer func() {
 			panic := recover()
 			if panic != nil {
-				log.Debug("↧↧↧↧↧↧ PANIC ↧↧↧↧↧↧")
-				log.Debug(panic)
-				for i := 3; ; i++ {
-					_, file, line, ok := runtime.Caller(i)
-					if !ok {
-						break
-					}
-					log.Debugf("%s:%d", file, line)
+				stack := debug.Stack()
+				if hp, ok := panic.(*handlerPanic); ok {
+					panic, stack = hp.value, hp.stack
 				}
-				log.Debug("↥↥↥↥↥↥ PANIC ↥↥↥↥↥↥")
+				report := &PanicReport{
+					Time:      time.Now(),
+					Value:     panicValue(panic),
+					Stack:     string(stack),
+					RequestID: RequestID(c),
+					Method:    c.Request.Method,
+					URL:       c.Request.URL.RequestURI(),
+					ClientIP:  c.ClientIP(),
+				}
+				s.reportPanic(report)
 
-				s.internalServerErrorResp(c, fmt.Errorf("panic when deal with request [%s] %s", c.Request.Method, c.Request.URL), "")
+				var details interface{}
+				if s.exposePanicStack {
+					details = panicDetails(report)
+				}
+				errRespWithDetails(c, http.StatusInternalServerError, "InternalServerError", "", details)
 			}
 		}()
 
@@ -103,37 +208,52 @@ func (s *Server) recover() HandlerFunc {
 }
 
 func (s *Server) invalidParameterResp(c *Context, err error, msg string) {
-	log.Debugf("InvalidParameterResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Debugf("InvalidParameterResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	InvalidParameterResp(c, msg)
 }
 
 func (s *Server) authenticationErrorResp(c *Context, err error, msg string) {
-	log.Debugf("AuthenticationErrorResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Debugf("AuthenticationErrorResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	AuthenticationErrorResp(c, msg)
 }
 
 func (s *Server) authenticationExpiredResp(c *Context, err error, msg string) {
-	log.Debugf("AuthenticationExpiredResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Debugf("AuthenticationExpiredResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	AuthenticationExpiredResp(c, msg)
 }
 
 func (s *Server) forbiddenResp(c *Context, err error, msg string) {
-	log.Debugf("ForbiddenResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Debugf("ForbiddenResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	ForbiddenResp(c, msg)
 }
 
 func (s *Server) notFoundResp(c *Context, err error, msg string) {
-	log.Debugf("NotFoundResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Debugf("NotFoundResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	NotFoundResp(c, msg)
 }
 
+func (s *Server) conflictResp(c *Context, err error, msg string) {
+	logger.WithField("request_id", RequestID(c)).Debugf("ConflictResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	ConflictResp(c, msg)
+}
+
+func (s *Server) tooManyRequestsResp(c *Context, err error, msg string) {
+	logger.WithField("request_id", RequestID(c)).Debugf("TooManyRequestsResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	TooManyRequestsResp(c, msg)
+}
+
 func (s *Server) internalServerErrorResp(c *Context, err error, msg string) {
-	log.Errorf("InternalServerErrorResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Errorf("InternalServerErrorResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	InternalServerErrorResp(c, msg)
 }
 
+func (s *Server) serviceUnavailableResp(c *Context, err error, msg string) {
+	logger.WithField("request_id", RequestID(c)).Errorf("ServiceUnavailableResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	ServiceUnavailableResp(c, msg)
+}
+
 func (s *Server) timeoutErrorResp(c *Context, err error, msg string) {
-	log.Debugf("TimeoutErrorResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
+	logger.WithField("request_id", RequestID(c)).Debugf("TimeoutErrorResp: %v from %s request [%s] %s", err, c.ClientIP(), c.Request.Method, c.Request.URL)
 	TimeoutErrorResp(c, msg)
 }
 
@@ -167,95 +287,327 @@ func (s *Server) addRoutes(prefix string, middlewares []HandlerFunc, routes []ro
 	}
 }
 
-// Run starts the server to service http request.
-func (s *Server) Run() {
-	if s.enableAutoCert {
-		s.runWithAutoTLS()
-		return
+// Run binds the addresses of OptListen, or the address of the server if there is none,
+// and starts the server to service http request on all of them. It returns error if the
+// server can not start. A later failure of serving is reported by Done and Err.
+func (s *Server) Run() error {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return errors.New("server is already running")
 	}
-	s.run()
-}
 
-// run starts the server without encryption.
-func (s *Server) run() {
-	s.server = &http.Server{
-		Addr:         s.address,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
-		Handler:      s.handler,
+	if s.enableAutoCert && s.tlsCertFile != "" {
+		return errors.New("OptAutoCert and OptTLS can not be used together")
 	}
 
-	go func() {
-		s.mu.Lock()
-		s.running = true
-		s.mu.Unlock()
+	err := s.runAdmin()
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.enableAutoCert:
+		err = s.runWithAutoTLS()
+	case s.tlsCertFile != "":
+		err = s.runWithTLS()
+	default:
+		err = s.run()
+	}
+	if err != nil {
+		s.stopAdmin()
+	}
+	return err
+}
 
-		log.Debugf("listen on %s", s.address)
-		err := s.server.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
-			log.Errorf("listen error %s", err)
-		}
+// newHTTPServer returns a http.Server configured by the options.
+func (s *Server) newHTTPServer() *http.Server {
+	return &http.Server{
+		Addr:              s.address,
+		ReadTimeout:       s.readTimeout,
+		ReadHeaderTimeout: s.readHeaderTimeout,
+		WriteTimeout:      s.writeTimeout,
+		IdleTimeout:       s.idleTimeout,
+		MaxHeaderBytes:    s.maxHeaderBytes,
+		Handler:           s.handler,
+		ConnState:         s.trackConn,
+	}
+}
 
-		s.mu.Lock()
-		s.running = false
-		s.mu.Unlock()
-	}()
+// run starts the server without encryption.
+func (s *Server) run() error {
+	s.server = s.newHTTPServer()
+
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	for _, ln := range lns {
+		logger.Debugf("listen on %s", ln.Addr())
+	}
+	s.serve(lns)
+	return nil
 }
 
-// runWithAutoTLS starts the server without Let's Encrypt.
-func (s *Server) runWithAutoTLS() {
+// runWithAutoTLS starts the server with Let's Encrypt. The certificates are fetched via
+// ACME, and a companion server listening on the autocert HTTP address answers HTTP-01
+// challenges and redirects other requests to HTTPS.
+func (s *Server) runWithAutoTLS() error {
 	if len(s.autoCertDomains) == 0 {
-		log.Debug("runWithAutoTLS failed: no any domain for autocert")
-		return
+		return errors.New("runWithAutoTLS failed: no any domain for autocert")
 	}
-	m := autocert.Manager{
+	m := &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
 		HostPolicy: autocert.HostWhitelist(s.autoCertDomains...),
 	}
 	if s.autoCertCacheDirPath != "" {
 		m.Cache = autocert.DirCache(s.autoCertCacheDirPath)
 	}
-	s.server = &http.Server{
-		Addr:         s.address,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
-		Handler:      s.handler,
-		TLSConfig:    &tls.Config{GetCertificate: m.GetCertificate},
+	if s.autoCertDirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: s.autoCertDirectoryURL}
+	}
+	s.server = s.newHTTPServer()
+	s.server.TLSConfig = s.newTLSConfig()
+	s.server.TLSConfig.GetCertificate = m.GetCertificate
+	s.server.TLSConfig.NextProtos = m.TLSConfig().NextProtos
+
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	challengeLn, err := net.Listen("tcp", s.autoCertHTTPAddress)
+	if err != nil {
+		closeListeners(lns)
+		return fmt.Errorf("listen on %s failed: %v", s.autoCertHTTPAddress, err)
 	}
 
-	go func() {
-		s.mu.Lock()
-		s.running = true
-		s.mu.Unlock()
-
-		log.Infof("listen on %s", s.address)
-		err := s.server.ListenAndServe()
+	s.challengeServer = &http.Server{
+		Handler:      m.HTTPHandler(nil),
+		ReadTimeout:  s.readTimeout,
+		WriteTimeout: s.writeTimeout,
+		IdleTimeout:  s.idleTimeout,
+	}
+	s.challengeListener = challengeLn
+	go func(srv *http.Server) {
+		logger.Infof("listen on %s for ACME HTTP-01 challenges", challengeLn.Addr())
+		err := srv.Serve(challengeLn)
 		if err != nil && err != http.ErrServerClosed {
-			log.Errorf("listen error %s", err)
+			logger.Errorf("serve ACME HTTP-01 challenges error %s", err)
 		}
+	}(s.challengeServer)
+
+	for _, ln := range lns {
+		logger.Infof("listen on %s", ln.Addr())
+	}
+	s.serve(lns)
+	return nil
+}
 
+// serve serves the listeners in goroutines. TLS is used if the TLSConfig of s.server is
+// set. If serving one of them fails, the others are closed too, and the server is done
+// when all of them stop. The caller must hold s.mu.
+func (s *Server) serve(lns []net.Listener) {
+	s.running = true
+	atomic.StoreInt32(&s.draining, 0)
+	s.listeners = lns
+	s.err = nil
+	done := make(chan struct{})
+	s.done = done
+
+	// Decide it before serving, since Serve sets up HTTP/2 with a TLSConfig
+	srv := s.server
+	useTLS := srv.TLSConfig != nil
+	wg := sync.WaitGroup{}
+	for _, ln := range lns {
+		wg.Add(1)
+		go func(ln net.Listener) {
+			defer wg.Done()
+			var err error
+			if useTLS {
+				err = srv.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err == nil || err == http.ErrServerClosed {
+				return
+			}
+
+			logger.Errorf("serve error %s", err)
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = err
+			}
+			s.mu.Unlock()
+			ln.Close()
+			srv.Close()
+		}(ln)
+	}
+
+	// Close the companion servers and call the OnShutdown hooks too if serving fails,
+	// since Stop returns early when the server is not running. Stop takes them otherwise.
+	go func() {
+		wg.Wait()
 		s.mu.Lock()
+		failed := s.running
 		s.running = false
+		challengeServer := s.challengeServer
+		s.challengeServer = nil
+		adminServer := s.adminServer
+		s.adminServer = nil
 		s.mu.Unlock()
+		if challengeServer != nil {
+			challengeServer.Close()
+		}
+		if adminServer != nil {
+			adminServer.Close()
+		}
+		if failed {
+			atomic.StoreInt32(&s.draining, 1)
+			s.runShutdownHooks()
+		}
+		close(done)
 	}()
 }
 
-// Stop will stop the http server service. Return error if it occurs.
-func (s *Server) Stop() error {
+// Addr returns the address of the first listener of the server. It returns nil if the
+// server has never run.
+func (s *Server) Addr() net.Addr {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if !s.running {
-		log.Debug("stop server: server is not running")
+	if len(s.listeners) == 0 {
 		return nil
 	}
+	return s.listeners[0].Addr()
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Addrs returns the addresses of all listeners of the server, in the order of
+// OptListen. It returns nil if the server has never run.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	addrs := []net.Addr{}
+	for _, ln := range s.listeners {
+		addrs = append(addrs, ln.Addr())
+	}
+	return addrs
+}
+
+// Done returns a channel which is closed when the server stops serving, either by Stop
+// or by a failure.
+func (s *Server) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// Err returns the error which makes the server stop serving. It returns nil if the
+// server is running or stopped by Stop.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// trackConn records the state of connections so Stop can report how many of them are
+// force closed.
+func (s *Server) trackConn(conn net.Conn, state http.ConnState) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, conn)
+	default:
+		s.conns[conn] = state
+	}
+}
+
+// countConns returns the number of tracked connections.
+func (s *Server) countConns() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	return len(s.conns)
+}
+
+// Ready reports whether the server is accepting new requests. It turns false as soon as
+// Stop is called.
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.draining) == 0
+}
+
+// runShutdownHooks calls the hooks of OptOnShutdown in order.
+func (s *Server) runShutdownHooks() {
+	for _, hook := range s.onShutdown {
+		hook()
+	}
+}
+
+// ShutdownSummary reports the outcome of Stop.
+type ShutdownSummary struct {
+	// Duration is how long the shutdown took.
+	Duration time.Duration
+	// Drained is the number of connections closed gracefully.
+	Drained int
+	// ForceClosed is the number of connections closed because the timeout was exceeded.
+	ForceClosed int
+}
+
+// Stop will stop the http server service. It flips the readiness, waits for the
+// shutdown delay, then drains in-flight requests until the shutdown timeout is exceeded
+// and force closes the remaining connections. The OnShutdown hooks are called at the
+// end. Return error if it occurs.
+func (s *Server) Stop() (ShutdownSummary, error) {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		logger.Debug("stop server: server is not running")
+		return ShutdownSummary{}, nil
+	}
 
 	s.running = false
+	start := time.Now()
+	atomic.StoreInt32(&s.draining, 1)
+	srv := s.server
+	challengeServer := s.challengeServer
+	s.challengeServer = nil
+	adminServer := s.adminServer
+	s.adminServer = nil
+	s.mu.Unlock()
+
+	if s.shutdownDelay > 0 {
+		logger.Debugf("stop server: wait %s before draining", s.shutdownDelay)
+		time.Sleep(s.shutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	active := s.countConns()
+	logger.Debugf("stop server: draining %d connections", active)
+	summary := ShutdownSummary{}
+	err := srv.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		summary.ForceClosed = s.countConns()
+		err = srv.Close()
+	}
+	if challengeServer != nil {
+		challengeServer.Close()
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+	if summary.Drained = active - summary.ForceClosed; summary.Drained < 0 {
+		summary.Drained = 0
+	}
+
+	s.runShutdownHooks()
 
-	log.Debug("stop server")
-	return s.server.Shutdown(ctx)
+	summary.Duration = time.Since(start)
+	logger.Debugf("stop server: drained %d, force closed %d in %s", summary.Drained, summary.ForceClosed, summary.Duration)
+	return summary, err
 }
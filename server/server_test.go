@@ -1,21 +1,34 @@
 package server
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/mikunalpha/httpsrvtpl/logging"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
 func init() {
 	log.SetOutput(os.Stdout)
-	log.SetLevel(log.PanicLevel)
+	logging.SetLevel(log.PanicLevel)
 }
 
 func TestServer(t *testing.T) {
@@ -51,9 +64,9 @@ func TestServer(t *testing.T) {
 	s.addRoutes("", nil, []route{
 		{"GET", "/panic", func(c *Context) { panic("panic") }},
 	})
-	status, respBody = sendRequestFunc(s.handler, "GET", "/panic", nil, nil)
+	status, respBody = sendRequestFunc(s.handler, "GET", "/panic", H{"X-Request-ID": "abc"}, nil)
 	assert.Equal(t, http.StatusInternalServerError, status, "should be equal")
-	assert.Equal(t, `{"error":{"code":"InternalServerError","msg":"Internal Server Error"}}`, respBody, "should be equal")
+	assert.Equal(t, `{"error":{"code":"InternalServerError","msg":"Internal Server Error","request_id":"abc"}}`, respBody, "should be equal")
 
 	// Test errresp uitl func
 	type testCase struct {
@@ -66,13 +79,16 @@ func TestServer(t *testing.T) {
 		ExpectedBodyString string
 	}
 	testCases := []testCase{
-		{"GET", "/invalidparameter", nil, nil, func(c *Context) { s.invalidParameterResp(c, nil, "") }, http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter"}}`},
-		{"GET", "/authenticationerror", nil, nil, func(c *Context) { s.authenticationErrorResp(c, nil, "") }, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error"}}`},
-		{"GET", "/authenticationexpired", nil, nil, func(c *Context) { s.authenticationExpiredResp(c, nil, "") }, http.StatusUnauthorized, `{"error":{"code":"AuthenticationExpired","msg":"Authentication Expired"}}`},
-		{"GET", "/forbidden", nil, nil, func(c *Context) { s.forbiddenResp(c, nil, "") }, http.StatusForbidden, `{"error":{"code":"Forbidden","msg":"Forbidden"}}`},
-		{"GET", "/notfound", nil, nil, func(c *Context) { s.notFoundResp(c, nil, "") }, http.StatusNotFound, `{"error":{"code":"NotFound","msg":"Not Found"}}`},
-		{"GET", "/internalservererror", nil, nil, func(c *Context) { s.internalServerErrorResp(c, nil, "") }, http.StatusInternalServerError, `{"error":{"code":"InternalServerError","msg":"Internal Server Error"}}`},
-		{"GET", "/timeouterror", nil, nil, func(c *Context) { s.timeoutErrorResp(c, nil, "") }, http.StatusGatewayTimeout, `{"error":{"code":"TimeoutError","msg":"Gateway Timeout"}}`},
+		{"GET", "/invalidparameter", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.invalidParameterResp(c, nil, "") }, http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","request_id":"abc"}}`},
+		{"GET", "/authenticationerror", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.authenticationErrorResp(c, nil, "") }, http.StatusUnauthorized, `{"error":{"code":"AuthenticationError","msg":"Authentication Error","request_id":"abc"}}`},
+		{"GET", "/authenticationexpired", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.authenticationExpiredResp(c, nil, "") }, http.StatusUnauthorized, `{"error":{"code":"AuthenticationExpired","msg":"Authentication Expired","request_id":"abc"}}`},
+		{"GET", "/forbidden", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.forbiddenResp(c, nil, "") }, http.StatusForbidden, `{"error":{"code":"Forbidden","msg":"Forbidden","request_id":"abc"}}`},
+		{"GET", "/notfound", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.notFoundResp(c, nil, "") }, http.StatusNotFound, `{"error":{"code":"NotFound","msg":"Not Found","request_id":"abc"}}`},
+		{"GET", "/conflict", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.conflictResp(c, nil, "") }, http.StatusConflict, `{"error":{"code":"Conflict","msg":"Conflict","request_id":"abc"}}`},
+		{"GET", "/toomanyrequests", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.tooManyRequestsResp(c, nil, "") }, http.StatusTooManyRequests, `{"error":{"code":"TooManyRequests","msg":"Too Many Requests","request_id":"abc"}}`},
+		{"GET", "/internalservererror", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.internalServerErrorResp(c, nil, "") }, http.StatusInternalServerError, `{"error":{"code":"InternalServerError","msg":"Internal Server Error","request_id":"abc"}}`},
+		{"GET", "/serviceunavailable", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.serviceUnavailableResp(c, nil, "") }, http.StatusServiceUnavailable, `{"error":{"code":"ServiceUnavailable","msg":"Service Unavailable","request_id":"abc"}}`},
+		{"GET", "/timeouterror", H{"X-Request-ID": "abc"}, nil, func(c *Context) { s.timeoutErrorResp(c, nil, "") }, http.StatusGatewayTimeout, `{"error":{"code":"TimeoutError","msg":"Gateway Timeout","request_id":"abc"}}`},
 	}
 	for i := range testCases {
 		switch testCases[i].Method {
@@ -99,12 +115,13 @@ func TestServer(t *testing.T) {
 	}
 
 	// Test run
-	stop := make(chan os.Signal)
+	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 	time.AfterFunc(3*time.Second, func() {
 		stop <- os.Interrupt
 	})
-	s.Run()
+	err := s.Run()
+	assert.Nil(t, err, "should be nil")
 	<-stop
 	// Use sync.Mutex to avoid data race on s.running
 	s.mu.Lock()
@@ -116,3 +133,263 @@ func TestServer(t *testing.T) {
 	s.mu.Unlock()
 	s.Stop()
 }
+
+func TestServerStop(t *testing.T) {
+	var hookCalled int32
+	s := New("127.0.0.1:18889",
+		OptShutdownTimeout(500*time.Millisecond),
+		OptShutdownDelay(100*time.Millisecond),
+		OptOnShutdown(func() { atomic.AddInt32(&hookCalled, 1) }),
+		OptAddPingHandler(),
+	)
+	started := make(chan struct{})
+	s.addRoutes("", nil, []route{
+		{"GET", "/slow", func(c *Context) {
+			close(started)
+			time.Sleep(3 * time.Second)
+			c.String(http.StatusOK, "slow")
+		}},
+	})
+	err := s.Run()
+	assert.Nil(t, err, "should be nil")
+
+	go http.Get("http://127.0.0.1:18889/slow")
+	<-started
+
+	assert.Equal(t, true, s.Ready(), "should be equal")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, false, s.Ready(), "should be equal")
+		req := httptest.NewRequest("GET", "http://xxx.com/ping", nil)
+		respRecorder := httptest.NewRecorder()
+		s.handler.ServeHTTP(respRecorder, req)
+		assert.Equal(t, http.StatusServiceUnavailable, respRecorder.Code, "should be equal")
+	}()
+
+	summary, err := s.Stop()
+	assert.Nil(t, err, "should be nil")
+	<-s.Done()
+	assert.Nil(t, s.Err(), "should be nil")
+	assert.Equal(t, 1, summary.ForceClosed, "should be equal")
+	assert.Equal(t, 0, summary.Drained, "should be equal")
+	assert.Equal(t, true, summary.Duration >= 600*time.Millisecond, "should be true")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hookCalled), "should be equal")
+
+	// Hooks are not called again when the server is not running
+	summary, err = s.Stop()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, ShutdownSummary{}, summary, "should be equal")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hookCalled), "should be equal")
+
+	// Test the server is ready again when it runs again, and hooks are called once when
+	// serving fails
+	err = s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	assert.Equal(t, true, s.Ready(), "should be equal")
+	s.mu.Lock()
+	s.listeners[0].Close()
+	s.mu.Unlock()
+	select {
+	case <-s.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should be done")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hookCalled), "should be equal")
+	assert.Equal(t, false, s.Ready(), "should be equal")
+	s.Stop()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hookCalled), "should be equal")
+
+	// Test an in-flight admin request which locks the server is drained
+	var reloaded int32
+	started = make(chan struct{})
+	s = New("127.0.0.1:0",
+		OptShutdownTimeout(3*time.Second),
+		OptAdminToken("secret"),
+		OptAddReloadHandler(func() error {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			err := s.Reload(ReloadConfig{})
+			atomic.AddInt32(&reloaded, 1)
+			return err
+		}),
+	)
+	err = s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	status := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest("POST", "http://"+s.Addr().String()+"/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+	summary, err = s.Stop()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 0, summary.ForceClosed, "should be equal")
+	assert.Equal(t, 1, summary.Drained, "should be equal")
+	assert.Equal(t, true, summary.Duration < 3*time.Second, "should be true")
+	assert.Equal(t, http.StatusOK, <-status, "should be equal")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloaded), "should be equal")
+}
+
+func TestServerRun(t *testing.T) {
+	s := New("127.0.0.1:0")
+	assert.Nil(t, s.Addr(), "should be nil")
+	err := s.Run()
+	assert.Nil(t, err, "should be nil")
+	assert.NotNil(t, s.Addr(), "should not be nil")
+
+	// Run twice
+	err = s.Run()
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test port conflict
+	s2 := New(s.Addr().String())
+	err = s2.Run()
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test serve failure is reported by Done and Err
+	s.mu.Lock()
+	s.listeners[0].Close()
+	s.mu.Unlock()
+	select {
+	case <-s.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should be done")
+	}
+	assert.NotNil(t, s.Err(), "should not be nil")
+
+	// Test autocert without domains
+	s3 := New("127.0.0.1:0", OptAutoCert(""))
+	err = s3.Run()
+	assert.NotNil(t, err, "should not be nil")
+}
+
+func TestServerRunWithAutoTLS(t *testing.T) {
+	// Put a self-signed certificate into the autocert cache, so no ACME server is needed
+	cacheDir, err := os.MkdirTemp("", "autocert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "abc.fake.com"},
+		DNSNames:     []string{"abc.fake.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached bytes.Buffer
+	pem.Encode(&cached, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pem.Encode(&cached, &pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	err = os.WriteFile(filepath.Join(cacheDir, "abc.fake.com"), cached.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New("127.0.0.1:0",
+		OptAutoCert(cacheDir, "abc.fake.com"),
+		OptAutoCertDirectoryURL("http://127.0.0.1:1/dir"),
+		OptAutoCertHTTPAddress("127.0.0.1:0"),
+		OptAddPingHandler(),
+	)
+	err = s.Run()
+	assert.Nil(t, err, "should be nil")
+
+	// Test HTTPS is served with the cached certificate
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(certDER)
+	roots.AddCert(leaf)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: "abc.fake.com", RootCAs: roots},
+		},
+	}
+	resp, err := client.Get("https://" + s.Addr().String() + "/ping")
+	if assert.Nil(t, err, "should be nil") {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should be equal")
+		assert.Equal(t, `{"ping":"pong"}`, string(body), "should be equal")
+	}
+
+	// Test unknown domain is rejected without contacting ACME server
+	client.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{ServerName: "other.fake.com", RootCAs: roots},
+	}
+	_, err = client.Get("https://" + s.Addr().String() + "/ping")
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test the companion server redirects HTTP to HTTPS
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, _ := http.NewRequest("GET", "http://"+s.challengeListener.Addr().String()+"/ping", nil)
+	req.Host = "abc.fake.com"
+	resp, err = noRedirect.Do(req)
+	if assert.Nil(t, err, "should be nil") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode, "should be equal")
+		assert.Equal(t, "https://abc.fake.com/ping", resp.Header.Get("Location"), "should be equal")
+	}
+
+	// Test the companion server answers unknown HTTP-01 challenge with not found
+	req, _ = http.NewRequest("GET", "http://"+s.challengeListener.Addr().String()+"/.well-known/acme-challenge/token", nil)
+	req.Host = "abc.fake.com"
+	resp, err = noRedirect.Do(req)
+	if assert.Nil(t, err, "should be nil") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should be equal")
+	}
+
+	_, err = s.Stop()
+	assert.Nil(t, err, "should be nil")
+	s.mu.Lock()
+	assert.Nil(t, s.challengeServer, "should be nil")
+	s.mu.Unlock()
+
+	// Test the companion server is closed when serving fails
+	s = New("127.0.0.1:0",
+		OptAutoCert(cacheDir, "abc.fake.com"),
+		OptAutoCertDirectoryURL("http://127.0.0.1:1/dir"),
+		OptAutoCertHTTPAddress("127.0.0.1:0"),
+		OptAdminAddress("127.0.0.1:0"),
+	)
+	err = s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	challengeAddr := s.challengeListener.Addr().String()
+	adminAddr := s.AdminAddr().String()
+	s.mu.Lock()
+	s.listeners[0].Close()
+	s.mu.Unlock()
+	select {
+	case <-s.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should be done")
+	}
+	_, err = net.Dial("tcp", challengeAddr)
+	assert.NotNil(t, err, "should not be nil")
+	_, err = net.Dial("tcp", adminAddr)
+	assert.NotNil(t, err, "should not be nil")
+}
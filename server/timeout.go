@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeout is the middleware which limits the time a request can be handled. The handlers
+// after it run in a goroutine with a buffered response. When the timeout is exceeded, the
+// request context is cancelled and a TimeoutErrorResp is responded at once like
+// http.TimeoutHandler, and later writes of the handler fail with http.ErrHandlerTimeout.
+// The middleware still waits for the handler to return before the context is released,
+// so the connection is not reused until then. It can be attached to the routes groups in
+// addRoutes.
+func (s *Server) timeout(timeout time.Duration) HandlerFunc {
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		// Render the timeout response before the handler may change c concurrently
+		w := c.Writer
+		errW := newTimeoutWriter(w)
+		c.Writer = errW
+		TimeoutErrorResp(c, "")
+		requestID, clientIP := RequestID(c), c.ClientIP()
+		method, url := c.Request.Method, c.Request.URL.String()
+
+		tw := newTimeoutWriter(w)
+		c.Writer = tw
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- &handlerPanic{value: p, stack: debug.Stack()}
+				}
+				close(done)
+			}()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+
+			logger.WithField("request_id", requestID).Debugf("TimeoutErrorResp: %v from %s request [%s] %s", fmt.Errorf("request exceeds timeout %s", timeout), clientIP, method, url)
+			errW.header.Set("Content-Length", strconv.Itoa(errW.buf.Len()))
+			errW.flushTo(w)
+			w.Flush()
+			<-done
+		}
+		c.Writer = w
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		default:
+		}
+		if !tw.timedOut {
+			tw.flushTo(w)
+		}
+	}
+}
+
+// timeoutWriter buffers the response so it can be discarded when timeout is exceeded.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+
+	mu       sync.Mutex
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		ResponseWriter: w,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+	}
+}
+
+// flushTo writes the buffered response to w.
+func (w *timeoutWriter) flushTo(rw gin.ResponseWriter) {
+	for k, v := range w.header {
+		rw.Header()[k] = v
+	}
+	rw.WriteHeader(w.status)
+	if w.wroteHeader {
+		rw.Write(w.buf.Bytes())
+	}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if code > 0 && !w.wroteHeader {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wroteHeader = true
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wroteHeader = true
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wroteHeader {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wroteHeader
+}
+
+// Flush is a no-op, since the response is buffered until the handler returns.
+func (w *timeoutWriter) Flush() {}
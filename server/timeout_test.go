@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, http.Header, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Header(), respRecorder.Body.String()
+	}
+
+	var report *PanicReport
+	var panicLine string
+	s := New("0.0.0.0:8888", OptPanicReporter(PanicReporterFunc(func(r *PanicReport) { report = r })))
+	s.addRoutes("/api", []HandlerFunc{s.timeout(100 * time.Millisecond)}, []route{
+		{"GET", "/fast", func(c *Context) {
+			c.Header("X-Fast", "yes")
+			c.String(http.StatusCreated, "fast")
+		}},
+		{"GET", "/nocontent", func(c *Context) { c.Status(http.StatusNoContent) }},
+		{"GET", "/slow", func(c *Context) {
+			select {
+			case <-c.Request.Context().Done():
+			case <-time.After(3 * time.Second):
+			}
+			c.Header("X-Slow", "yes")
+			c.String(http.StatusOK, "slow")
+		}},
+		{"GET", "/ignore", func(c *Context) {
+			time.Sleep(200 * time.Millisecond)
+			c.String(http.StatusOK, "ignore")
+		}},
+		{"GET", "/panic", func(c *Context) {
+			_, file, line, _ := runtime.Caller(0)
+			panicLine = fmt.Sprintf("%s:%d", file, line+2)
+			panic("oops")
+		}},
+	})
+
+	status, header, respBody := sendRequestFunc(s.handler, "GET", "/api/fast", nil, nil)
+	assert.Equal(t, http.StatusCreated, status, "should be equal")
+	assert.Equal(t, "yes", header.Get("X-Fast"), "should be equal")
+	assert.Equal(t, "fast", respBody, "should be equal")
+
+	status, _, respBody = sendRequestFunc(s.handler, "GET", "/api/nocontent", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status, "should be equal")
+	assert.Equal(t, "", respBody, "should be equal")
+
+	start := time.Now()
+	status, header, respBody = sendRequestFunc(s.handler, "GET", "/api/slow", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, true, time.Since(start) < time.Second, "should be true")
+	assert.Equal(t, http.StatusGatewayTimeout, status, "should be equal")
+	assert.Equal(t, "", header.Get("X-Slow"), "should be equal")
+	assert.Equal(t, `{"error":{"code":"TimeoutError","msg":"Gateway Timeout","request_id":"abc"}}`, respBody, "should be equal")
+
+	status, _, respBody = sendRequestFunc(s.handler, "GET", "/api/ignore", H{"X-Request-ID": "abc"}, nil)
+	assert.Equal(t, http.StatusGatewayTimeout, status, "should be equal")
+	assert.Equal(t, `{"error":{"code":"TimeoutError","msg":"Gateway Timeout","request_id":"abc"}}`, respBody, "should be equal")
+
+	// Test a panic of the handler is recovered by the default middleware
+	status, _, _ = sendRequestFunc(s.handler, "GET", "/api/panic", nil, nil)
+	assert.Equal(t, http.StatusInternalServerError, status, "should be equal")
+	if assert.NotNil(t, report, "should not be nil") {
+		assert.Equal(t, "oops", report.Value, "should be equal")
+		assert.Contains(t, report.Stack, panicLine, "should contain the stack of the handler")
+	}
+
+	// Test the client gets the response when the timeout is exceeded, even if the handler
+	// ignores the context
+	s = New("127.0.0.1:0")
+	s.addRoutes("/api", []HandlerFunc{s.timeout(100 * time.Millisecond)}, []route{
+		{"GET", "/ignore", func(c *Context) {
+			time.Sleep(time.Second)
+			c.String(http.StatusOK, "ignore")
+		}},
+	})
+	err := s.Run()
+	if !assert.Nil(t, err, "should be nil") {
+		return
+	}
+	defer s.Stop()
+	start = time.Now()
+	resp, err := http.Get("http://" + s.Addr().String() + "/api/ignore")
+	if assert.Nil(t, err, "should be nil") {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, true, time.Since(start) < 500*time.Millisecond, "should be true")
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode, "should be equal")
+		assert.Contains(t, string(body), `{"error":{"code":"TimeoutError","msg":"Gateway Timeout"`, "should contain")
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader holds the certificate loaded from certFile and keyFile, and reloads it
+// when the files change. Established connections are not affected by reloading.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	leaf    *x509.Certificate
+	modTime time.Time
+}
+
+// newCertReloader returns a certReloader with the certificate loaded.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	return r, r.reload()
+}
+
+// loadedCert is the certificate loaded from files by certReloader.
+type loadedCert struct {
+	cert    *tls.Certificate
+	leaf    *x509.Certificate
+	modTime time.Time
+}
+
+// reload loads the certificate from files. The current certificate is kept if it fails.
+func (r *certReloader) reload() error {
+	lc, err := r.load()
+	if err != nil {
+		return err
+	}
+	r.set(lc)
+	return nil
+}
+
+// load loads the certificate from files without using it.
+func (r *certReloader) load() (*loadedCert, error) {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed: %v", err)
+	}
+	return &loadedCert{cert: &cert, leaf: leaf, modTime: modTime}, nil
+}
+
+// set uses the loaded certificate for new connections.
+func (r *certReloader) set(lc *loadedCert) {
+	r.mu.Lock()
+	r.cert = lc.cert
+	r.leaf = lc.leaf
+	r.modTime = lc.modTime
+	r.mu.Unlock()
+
+	logger.Infof("certificate %s loaded, expires at %s", r.certFile, lc.leaf.NotAfter.Format(time.RFC3339))
+}
+
+// filesModTime returns the latest modification time of certFile and keyFile.
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return modTime, err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// watch checks the files every interval and reloads the certificate if they change,
+// until done is closed.
+func (r *certReloader) watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.filesModTime()
+		if err != nil {
+			logger.Errorf("watch certificate failed: %v", err)
+			continue
+		}
+		r.mu.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		err = r.reload()
+		if err != nil {
+			logger.Errorf("reload certificate failed: %v", err)
+		}
+	}
+}
+
+// getCertificate implements the tls.Config.GetCertificate hook.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// notAfter returns the expiry date of the loaded certificate.
+func (r *certReloader) notAfter() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.leaf.NotAfter
+}
+
+// newTLSConfig returns a tls.Config with the minimum version, cipher suites and client
+// authentication set by the options.
+func (s *Server) newTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   s.tlsMinVersion,
+		CipherSuites: s.tlsCipherSuites,
+		ClientCAs:    s.tlsClientCAs,
+		ClientAuth:   s.tlsClientAuth,
+	}
+}
+
+// runWithTLS starts the server with the certificate set by OptTLS.
+func (s *Server) runWithTLS() error {
+	reloader, err := newCertReloader(s.tlsCertFile, s.tlsKeyFile)
+	if err != nil {
+		return fmt.Errorf("runWithTLS failed: %v", err)
+	}
+
+	s.server = s.newHTTPServer()
+	s.server.TLSConfig = s.newTLSConfig()
+	s.server.TLSConfig.GetCertificate = reloader.getCertificate
+
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	for _, ln := range lns {
+		logger.Infof("listen on %s", ln.Addr())
+	}
+	s.certReloader = reloader
+	s.serve(lns)
+	if s.tlsReloadInterval > 0 {
+		go reloader.watch(s.tlsReloadInterval, s.done)
+	}
+	return nil
+}
+
+// ReloadCert reloads the certificate set by OptTLS, e.g. when SIGHUP is received. The
+// current certificate is kept if it fails.
+func (s *Server) ReloadCert() error {
+	s.mu.Lock()
+	reloader := s.certReloader
+	s.mu.Unlock()
+	if reloader == nil {
+		return errors.New("reload certificate failed: server is not running with OptTLS")
+	}
+	return reloader.reload()
+}
+
+// debugTLSHandler responds the information of the certificate loaded by OptTLS.
+func (s *Server) debugTLSHandler(c *Context) {
+	s.mu.Lock()
+	reloader := s.certReloader
+	s.mu.Unlock()
+	if reloader == nil {
+		s.notFoundResp(c, errors.New("server is not running with OptTLS"), "")
+		return
+	}
+
+	c.JSON(http.StatusOK, &struct {
+		CertFile string    `json:"cert_file"`
+		NotAfter time.Time `json:"not_after"`
+	}{reloader.certFile, reloader.notAfter()})
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertFiles writes a self-signed certificate for localhost into certFile and keyFile.
+func writeCertFiles(t *testing.T, certFile, keyFile, cn string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerRunWithTLS(t *testing.T) {
+	dir, err := os.MkdirTemp("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	writeCertFiles(t, certFile, keyFile, "first", notAfter)
+
+	// peerCNFunc connects with a new connection and returns the CN of server certificate
+	var peerCNFunc = func(addr string, maxVersion uint16) (string, error) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: maxVersion})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	s := New("127.0.0.1:0",
+		OptTLS(certFile, keyFile),
+		OptTLSReloadInterval(50*time.Millisecond),
+		OptTLSMinVersion(tls.VersionTLS12),
+		OptTLSCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256),
+		OptAddPingHandler(),
+		OptAddDebugHandler(),
+		OptAdminAllowIPs("192.0.2.1"),
+	)
+	err = s.Run()
+	assert.Nil(t, err, "should be nil")
+	addr := s.Addr().String()
+
+	// Test HTTPS is served
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + addr + "/ping")
+	if assert.Nil(t, err, "should be nil") {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, `{"ping":"pong"}`, string(body), "should be equal")
+	}
+	cn, err := peerCNFunc(addr, 0)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "first", cn, "should be equal")
+
+	// Test minimum TLS version
+	_, err = peerCNFunc(addr, tls.VersionTLS11)
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test expiry date in debug route
+	req := httptest.NewRequest("GET", "http://xxx.com/debug/tls", nil)
+	respRecorder := httptest.NewRecorder()
+	s.handler.ServeHTTP(respRecorder, req)
+	assert.Equal(t, http.StatusOK, respRecorder.Code, "should be equal")
+	assert.Equal(t, `{"cert_file":"`+certFile+`","not_after":"`+notAfter.UTC().Format(time.RFC3339)+`"}`, respRecorder.Body.String(), "should be equal")
+
+	// Test reloading when files change
+	later := time.Now().Add(time.Second)
+	writeCertFiles(t, certFile, keyFile, "second", notAfter)
+	os.Chtimes(certFile, later, later)
+	time.Sleep(300 * time.Millisecond)
+	cn, err = peerCNFunc(addr, 0)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "second", cn, "should be equal")
+
+	// Test ReloadCert keeps the current certificate if it fails
+	os.WriteFile(keyFile, []byte("broken"), 0600)
+	err = s.ReloadCert()
+	assert.NotNil(t, err, "should not be nil")
+	cn, err = peerCNFunc(addr, 0)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "second", cn, "should be equal")
+
+	// Test ReloadCert
+	writeCertFiles(t, certFile, keyFile, "third", notAfter)
+	err = s.ReloadCert()
+	assert.Nil(t, err, "should be nil")
+	cn, err = peerCNFunc(addr, 0)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, "third", cn, "should be equal")
+
+	_, err = s.Stop()
+	assert.Nil(t, err, "should be nil")
+
+	// Test missing files
+	s = New("127.0.0.1:0", OptTLS(filepath.Join(dir, "none.pem"), keyFile))
+	err = s.Run()
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test OptTLS with OptAutoCert
+	s = New("127.0.0.1:0", OptTLS(certFile, keyFile), OptAutoCert("", "abc.fake.com"))
+	err = s.Run()
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test ReloadCert and debug route without OptTLS
+	s = New("127.0.0.1:0", OptAddDebugHandler(), OptAdminAllowIPs("192.0.2.1"))
+	err = s.ReloadCert()
+	assert.NotNil(t, err, "should not be nil")
+	req = httptest.NewRequest("GET", "http://xxx.com/debug/tls", nil)
+	respRecorder = httptest.NewRecorder()
+	s.handler.ServeHTTP(respRecorder, req)
+	assert.Equal(t, http.StatusNotFound, respRecorder.Code, "should be equal")
+}
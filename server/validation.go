@@ -0,0 +1,197 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is the validation error of a field.
+type FieldError struct {
+	// Field is the path of the field named by its json or form tag, e.g. items[0].name.
+	Field string `json:"field"`
+	// Rule is the failed rule in the binding tag, e.g. required.
+	Rule string `json:"rule"`
+	// Param is the parameter of the rule, e.g. 3 of min=3.
+	Param string `json:"param,omitempty"`
+	// Message is a readable description of the error.
+	Message string `json:"message"`
+}
+
+// ValidationErrors is the list of field errors returned by Validate.
+type ValidationErrors []FieldError
+
+// Error implements error.
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidationFunc checks the value of a field with the parameter of the rule.
+type ValidationFunc func(value interface{}, param string) bool
+
+// validationMessages are the message templates of rules. {field} and {param} are
+// replaced by the field path and the parameter of the rule.
+var validationMessages = map[string]string{
+	"required": "{field} is required",
+	"len":      "{field} must have length {param}",
+	"min":      "{field} must be at least {param}",
+	"max":      "{field} must be at most {param}",
+	"eq":       "{field} must be equal to {param}",
+	"ne":       "{field} must not be equal to {param}",
+	"gt":       "{field} must be greater than {param}",
+	"gte":      "{field} must be greater than or equal to {param}",
+	"lt":       "{field} must be less than {param}",
+	"lte":      "{field} must be less than or equal to {param}",
+	"oneof":    "{field} must be one of [{param}]",
+	"email":    "{field} must be a valid email address",
+	"url":      "{field} must be a valid URL",
+	"uuid":     "{field} must be a valid UUID",
+	"alphanum": "{field} must only contain letters and numbers",
+	"numeric":  "{field} must be numeric",
+}
+
+// defaultValidationMessage is used by the rules without message template.
+const defaultValidationMessage = "{field} does not satisfy {rule}"
+
+var (
+	validateMu sync.RWMutex
+	validate   = newValidate()
+)
+
+// newValidate returns a validator which reads rules from the binding tag like gin, and
+// names fields by their json tag, or form tag if json tag is absent.
+func newValidate() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+	return v
+}
+
+// RegisterValidation adds a custom rule used in binding tags, e.g. binding:"even". msg is
+// the message template of the rule, which can contain {field} and {param}. It should be
+// called before the server runs.
+func RegisterValidation(rule string, fn ValidationFunc, msg string) error {
+	validateMu.Lock()
+	defer validateMu.Unlock()
+	err := validate.RegisterValidation(rule, func(fl validator.FieldLevel) bool {
+		return fn(fl.Field().Interface(), fl.Param())
+	})
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		validationMessages[rule] = msg
+	}
+	return nil
+}
+
+// Validate checks obj against the rules in its binding tags, including the fields of
+// nested structs and, with dive, the elements of slices and maps. It returns
+// ValidationErrors if any field is invalid.
+func Validate(obj interface{}) error {
+	validateMu.RLock()
+	defer validateMu.RUnlock()
+
+	err := validate.Struct(obj)
+	if err == nil {
+		return nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+
+	errs := make(ValidationErrors, len(verrs))
+	for i, verr := range verrs {
+		errs[i] = FieldError{
+			Field: fieldPath(verr.Namespace()),
+			Rule:  verr.Tag(),
+			Param: verr.Param(),
+		}
+		errs[i].Message = validationMessage(errs[i])
+	}
+	return errs
+}
+
+// fieldPath trims the name of the top-level struct from namespace, e.g.
+// createItemReq.items[0].name becomes items[0].name.
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// validationMessage renders the message template of the rule of err.
+func validationMessage(err FieldError) string {
+	msg, ok := validationMessages[err.Rule]
+	if !ok {
+		msg = defaultValidationMessage
+	}
+	return strings.NewReplacer("{field}", err.Field, "{param}", err.Param, "{rule}", err.Rule).Replace(msg)
+}
+
+// localizeFieldErrors replaces the messages of errs with the ones of validation.<rule> in
+// OptMessageCatalog if they are found for the request.
+func localizeFieldErrors(c *Context, errs ValidationErrors) {
+	for i, err := range errs {
+		params := map[string]interface{}{"field": err.Field, "param": err.Param, "rule": err.Rule}
+		if msg, ok := lookupMessage(c, "validation."+err.Rule, params); ok {
+			errs[i].Message = msg
+		}
+	}
+}
+
+// BindAndValidate binds the request into obj and validates it. The source is chosen by
+// the method and content type: query string for GET and DELETE, JSON body for
+// application/json, and form for form-urlencoded and multipart requests. It returns an
+// InvalidParameter APIError with the ValidationErrors as details, so handlers can add it
+// by c.Error and return.
+//
+//	var req createItemReq
+//	if err := server.BindAndValidate(c, &req); err != nil {
+//		c.Error(err)
+//		return
+//	}
+func BindAndValidate(c *Context, obj interface{}) error {
+	b := binding.Default(c.Request.Method, c.ContentType())
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodDelete {
+		b = binding.Query
+	}
+
+	err := c.ShouldBindWith(obj, b)
+	if err != nil {
+		return NewAPIError(http.StatusBadRequest, "InvalidParameter", "").
+			WithCause(fmt.Errorf("bind %s failed: %v", b.Name(), err))
+	}
+
+	err = Validate(obj)
+	if err != nil {
+		apiErr := NewAPIError(http.StatusBadRequest, "InvalidParameter", "").WithCause(err)
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			localizeFieldErrors(c, errs)
+			apiErr = apiErr.WithDetails(errs)
+		}
+		return apiErr
+	}
+	return nil
+}
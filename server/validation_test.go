@@ -0,0 +1,108 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidation(t *testing.T) {
+	type H map[string]string
+
+	var sendRequestFunc = func(handler http.Handler, method, path string, headers map[string]string, requestBody io.Reader) (int, string) {
+		req := httptest.NewRequest(method, "http://xxx.com"+path, requestBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		respRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(respRecorder, req)
+		return respRecorder.Code, respRecorder.Body.String()
+	}
+
+	err := RegisterValidation("even", func(value interface{}, param string) bool {
+		n, ok := value.(int)
+		return ok && n%2 == 0
+	}, "{field} must be an even number")
+	assert.Nil(t, err, "should be nil")
+
+	type tag struct {
+		Name string `json:"name" binding:"required,alphanum"`
+	}
+	type createItemReq struct {
+		Name     string   `json:"name" form:"name" binding:"required,min=3"`
+		Kind     string   `json:"kind" form:"kind" binding:"omitempty,oneof=book pen"`
+		Quantity int      `json:"quantity" form:"quantity" binding:"even"`
+		Owner    *tag     `json:"owner" binding:"omitempty"`
+		Tags     []tag    `json:"tags" binding:"max=2,dive"`
+		Emails   []string `json:"emails" binding:"dive,email"`
+	}
+	type listItemsReq struct {
+		Page int `form:"page" binding:"gte=1"`
+	}
+
+	// Test Validate
+	err = Validate(&createItemReq{Name: "pencil", Quantity: 2})
+	assert.Nil(t, err, "should be nil")
+	err = Validate(&createItemReq{Name: "ab", Kind: "cup", Quantity: 3, Owner: &tag{}, Tags: []tag{{"a"}, {"b-c"}}, Emails: []string{"a@b.com", "ab"}})
+	assert.Equal(t, ValidationErrors{
+		{Field: "name", Rule: "min", Param: "3", Message: "name must be at least 3"},
+		{Field: "kind", Rule: "oneof", Param: "book pen", Message: "kind must be one of [book pen]"},
+		{Field: "quantity", Rule: "even", Message: "quantity must be an even number"},
+		{Field: "owner.name", Rule: "required", Message: "owner.name is required"},
+		{Field: "tags[1].name", Rule: "alphanum", Message: "tags[1].name must only contain letters and numbers"},
+		{Field: "emails[1]", Rule: "email", Message: "emails[1] must be a valid email address"},
+	}, err, "should be equal")
+
+	// Test BindAndValidate
+	s := New("0.0.0.0:8888")
+	s.addRoutes("/api", nil, []route{
+		{"POST", "/items", func(c *Context) {
+			var req createItemReq
+			if err := BindAndValidate(c, &req); err != nil {
+				c.Error(err)
+				return
+			}
+			c.String(http.StatusCreated, req.Name)
+		}},
+		{"GET", "/items", func(c *Context) {
+			var req listItemsReq
+			if err := BindAndValidate(c, &req); err != nil {
+				c.Error(err)
+				return
+			}
+			c.JSON(http.StatusOK, req.Page)
+		}},
+	})
+
+	type testCase struct {
+		Method             string
+		Path               string
+		Headers            H
+		RequestBody        io.Reader
+		ExpectedStatusCode int
+		ExpectedBodyString string
+	}
+	testCases := []testCase{
+		{"POST", "/api/items", H{"Content-Type": "application/json"}, strings.NewReader(`{"name":"pencil"}`), http.StatusCreated, "pencil"},
+		{"POST", "/api/items", H{"Content-Type": "application/json"}, strings.NewReader(`{"tags":[{}]}`), http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","details":[{"field":"name","rule":"required","message":"name is required"},{"field":"tags[0].name","rule":"required","message":"tags[0].name is required"}],"request_id":"abc"}}`},
+		{"POST", "/api/items", H{"Content-Type": "application/json"}, strings.NewReader(`{"name":`), http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","request_id":"abc"}}`},
+		{"POST", "/api/items", H{"Content-Type": "application/x-www-form-urlencoded"}, strings.NewReader(`name=pen&quantity=4`), http.StatusCreated, "pen"},
+		{"POST", "/api/items", H{"Content-Type": "application/x-www-form-urlencoded"}, strings.NewReader(`name=pen&quantity=1`), http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","details":[{"field":"quantity","rule":"even","message":"quantity must be an even number"}],"request_id":"abc"}}`},
+		{"GET", "/api/items?page=2", nil, nil, http.StatusOK, "2"},
+		{"GET", "/api/items?page=0", nil, nil, http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","details":[{"field":"page","rule":"gte","param":"1","message":"page must be greater than or equal to 1"}],"request_id":"abc"}}`},
+		{"GET", "/api/items?page=x", nil, nil, http.StatusBadRequest, `{"error":{"code":"InvalidParameter","msg":"Invalid Parameter","request_id":"abc"}}`},
+	}
+	for _, c := range testCases {
+		if c.Headers == nil {
+			c.Headers = H{}
+		}
+		c.Headers["X-Request-ID"] = "abc"
+		status, respBody := sendRequestFunc(s.handler, c.Method, c.Path, c.Headers, c.RequestBody)
+		assert.Equal(t, c.ExpectedStatusCode, status, "should be equal")
+		assert.Equal(t, c.ExpectedBodyString, respBody, "should be equal")
+	}
+}
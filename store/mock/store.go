@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"context"
 	"sync"
 
 	"github.com/mikunalpha/httpsrvtpl/store"
@@ -23,7 +24,7 @@ type Store struct {
 }
 
 // Ping is a implementation of func store.Store.Ping. Try to touch the connected database.
-func (s *Store) Ping() error {
+func (s *Store) Ping(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -0,0 +1,271 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of postgres advisory lock held while migrating.
+const migrationLockID = 7355608
+
+// migrationFileRegexp matches file names like 0001_create_rate_limits.up.sql.
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration is a version of schema with the SQL to apply and revert it.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration is applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// loadMigrations reads migrations from fsys sorted by version.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(matches[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.name != matches[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, m.name, matches[2])
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if matches[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s lacks up or down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// MigrateUp applies all pending migrations. It returns the number of applied migrations.
+func (s *Store) MigrateUp() (int, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = s.withMigrationLock(func(conn *sql.Conn) error {
+		for _, m := range migrations {
+			applied, err := s.migrate(conn, m, true)
+			if err != nil {
+				return err
+			}
+			if applied {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrateDown reverts the latest n applied migrations. It returns the number of
+// reverted migrations.
+func (s *Store) MigrateDown(n int) (int, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = s.withMigrationLock(func(conn *sql.Conn) error {
+		for i := len(migrations) - 1; i >= 0 && count < n; i-- {
+			reverted, err := s.migrate(conn, migrations[i], false)
+			if err != nil {
+				return err
+			}
+			if reverted {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrationStatus returns the status of all migrations.
+func (s *Store) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := map[int]time.Time{}
+	err = s.withMigrationLock(func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_version")
+		if err != nil {
+			return translateError(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var at time.Time
+			err = rows.Scan(&version, &at)
+			if err != nil {
+				return translateError(err)
+			}
+			appliedAt[version] = at
+		}
+		return translateError(rows.Err())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		at, applied := appliedAt[m.version]
+		statuses[i] = MigrationStatus{Version: m.version, Name: m.name, Applied: applied, AppliedAt: at}
+	}
+	return statuses, nil
+}
+
+// withMigrationLock calls fn with a connection while holding the lock which prevents
+// other instances from migrating concurrently. Postgres uses an advisory lock. Sqlite
+// relies on the exclusive write lock taken by each migration.
+func (s *Store) withMigrationLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return translateError(err)
+	}
+	defer conn.Close()
+
+	if s.driver == "postgres" {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+		if err != nil {
+			return translateError(err)
+		}
+		defer func() {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+			if err != nil {
+				logger.Errorf("release migration lock failed: %v", err)
+			}
+		}()
+	}
+
+	// Create it under the lock, since concurrent CREATE TABLE IF NOT EXISTS may fail on
+	// postgres
+	err = s.createSchemaVersionTable(conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// createSchemaVersionTable creates the table recording applied migrations.
+func (s *Store) createSchemaVersionTable(conn *sql.Conn) error {
+	_, err := conn.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS schema_version (
+		version    INTEGER PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return translateError(err)
+}
+
+// migrate applies (up) or reverts (down) the migration in a transaction. It does nothing
+// and returns false if the migration is already applied or reverted.
+func (s *Store) migrate(conn *sql.Conn, m migration, up bool) (done bool, err error) {
+	ctx := context.Background()
+
+	begin := "BEGIN"
+	if s.driver == "sqlite3" {
+		// Take the write lock at once, so instances migrating concurrently wait here
+		begin = "BEGIN IMMEDIATE"
+	}
+	_, err = conn.ExecContext(ctx, begin)
+	if err != nil {
+		return false, translateError(err)
+	}
+	defer func() {
+		if err != nil || !done {
+			conn.ExecContext(ctx, "ROLLBACK")
+			return
+		}
+		_, err = conn.ExecContext(ctx, "COMMIT")
+		err = translateError(err)
+	}()
+
+	var count int
+	err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_version WHERE version = "+s.placeholder(1), m.version).Scan(&count)
+	if err != nil {
+		return false, translateError(err)
+	}
+	if (count > 0) == up {
+		return false, nil
+	}
+
+	if up {
+		logger.Infof("migrate up %d_%s", m.version, m.name)
+		_, err = conn.ExecContext(ctx, m.up)
+		if err != nil {
+			return false, fmt.Errorf("migrate up %d_%s failed: %v", m.version, m.name, err)
+		}
+		_, err = conn.ExecContext(ctx, "INSERT INTO schema_version (version, name) VALUES ("+s.placeholder(1)+", "+s.placeholder(2)+")", m.version, m.name)
+	} else {
+		logger.Infof("migrate down %d_%s", m.version, m.name)
+		_, err = conn.ExecContext(ctx, m.down)
+		if err != nil {
+			return false, fmt.Errorf("migrate down %d_%s failed: %v", m.version, m.name, err)
+		}
+		_, err = conn.ExecContext(ctx, "DELETE FROM schema_version WHERE version = "+s.placeholder(1), m.version)
+	}
+	if err != nil {
+		return false, translateError(err)
+	}
+	return true, nil
+}
+
+// placeholder returns the i-th bind parameter of the driver.
+func (s *Store) placeholder(i int) string {
+	if s.driver == "postgres" {
+		return "$" + strconv.Itoa(i)
+	}
+	return "?"
+}
@@ -0,0 +1,98 @@
+package sqlstore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := "file:" + filepath.Join(dir, "test.db") + "?_busy_timeout=5000"
+
+	// Test migrating concurrently
+	stores := make([]*Store, 3)
+	for i := range stores {
+		st, err := New(Config{Driver: "sqlite3", DSN: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		stores[i] = st.(*Store)
+	}
+	var wg sync.WaitGroup
+	counts := make([]int, len(stores))
+	errs := make([]error, len(stores))
+	for i := range stores {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i], errs[i] = stores[i].MigrateUp()
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for i := range stores {
+		assert.Nil(t, errs[i], "should be nil")
+		total += counts[i]
+	}
+	assert.Equal(t, 1, total, "should be equal")
+
+	// Test MigrationStatus
+	st := stores[0]
+	statuses, err := st.MigrationStatus()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 1, len(statuses), "should be equal")
+	assert.Equal(t, 1, statuses[0].Version, "should be equal")
+	assert.Equal(t, "create_rate_limits", statuses[0].Name, "should be equal")
+	assert.Equal(t, true, statuses[0].Applied, "should be equal")
+	assert.Equal(t, false, statuses[0].AppliedAt.IsZero(), "should be equal")
+	_, err = st.db.Exec("INSERT INTO rate_limits (bucket_key, tokens, updated_at) VALUES ('a', 1, 0)")
+	assert.Nil(t, err, "should be nil")
+
+	// Test MigrateUp again
+	count, err := st.MigrateUp()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 0, count, "should be equal")
+
+	// Test MigrateDown
+	count, err = st.MigrateDown(5)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 1, count, "should be equal")
+	statuses, err = st.MigrationStatus()
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, false, statuses[0].Applied, "should be equal")
+	_, err = st.db.Exec("INSERT INTO rate_limits (bucket_key, tokens, updated_at) VALUES ('a', 1, 0)")
+	assert.NotNil(t, err, "should not be nil")
+	count, err = st.MigrateDown(1)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, 0, count, "should be equal")
+
+	// Test loadMigrations
+	migrations, err := loadMigrations(fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("B")},
+		"m/0002_b.down.sql": {Data: []byte("-B")},
+		"m/0001_a.up.sql":   {Data: []byte("A")},
+		"m/0001_a.down.sql": {Data: []byte("-A")},
+		"m/README.md":       {Data: []byte("")},
+	}, "m")
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, []migration{{1, "a", "A", "-A"}, {2, "b", "B", "-B"}}, migrations, "should be equal")
+	_, err = loadMigrations(fstest.MapFS{
+		"m/0001_a.up.sql": {Data: []byte("A")},
+	}, "m")
+	assert.NotNil(t, err, "should not be nil")
+	_, err = loadMigrations(fstest.MapFS{
+		"m/0001_a.up.sql":   {Data: []byte("A")},
+		"m/0001_b.down.sql": {Data: []byte("-B")},
+	}, "m")
+	assert.NotNil(t, err, "should not be nil")
+}
@@ -0,0 +1,5 @@
+CREATE TABLE rate_limits (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at BIGINT NOT NULL
+);
@@ -0,0 +1,57 @@
+package sqlstore
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// TakeToken is a implementation of func store.RateLimiter.TakeToken. The bucket is
+// locked by the transaction, so instances sharing the database take tokens in turn. It
+// needs the rate_limits table created by MigrateUp. The insert comes first, so sqlite
+// takes the write lock at once.
+func (s *Store) TakeToken(key string, rate float64, burst int) (remaining float64, ok bool, err error) {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, translateError(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = translateError(tx.Commit())
+	}()
+
+	now := time.Now().UnixNano()
+	_, err = tx.ExecContext(ctx, "INSERT INTO rate_limits (bucket_key, tokens, updated_at) VALUES ("+s.placeholder(1)+", "+s.placeholder(2)+", "+s.placeholder(3)+") ON CONFLICT (bucket_key) DO NOTHING", key, float64(burst), now)
+	if err != nil {
+		return 0, false, translateError(err)
+	}
+
+	query := "SELECT tokens, updated_at FROM rate_limits WHERE bucket_key = " + s.placeholder(1)
+	if s.driver == "postgres" {
+		query += " FOR UPDATE"
+	}
+	var tokens float64
+	var updatedAt int64
+	err = tx.QueryRowContext(ctx, query, key).Scan(&tokens, &updatedAt)
+	if err != nil {
+		return 0, false, translateError(err)
+	}
+
+	if now > updatedAt {
+		tokens = math.Min(float64(burst), tokens+float64(now-updatedAt)/float64(time.Second)*rate)
+	}
+	if tokens >= 1 {
+		tokens--
+		ok = true
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE rate_limits SET tokens = "+s.placeholder(1)+", updated_at = "+s.placeholder(2)+" WHERE bucket_key = "+s.placeholder(3), tokens, now, key)
+	if err != nil {
+		return 0, false, translateError(err)
+	}
+	return tokens, ok, nil
+}
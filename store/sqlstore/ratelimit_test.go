@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikunalpha/httpsrvtpl/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeToken(t *testing.T) {
+	st, err := New(Config{Driver: "sqlite3", DSN: "file:" + t.TempDir() + "/ratelimit.db?_busy_timeout=5000", MaxOpenConns: 4})
+	assert.Nil(t, err, "should be nil")
+	defer st.Close()
+	s := st.(*Store)
+	var _ store.RateLimiter = s
+
+	// Test without table
+	_, _, err = s.TakeToken("ip:1", 1, 2)
+	assert.NotNil(t, err, "should not be nil")
+
+	_, err = s.MigrateUp()
+	assert.Nil(t, err, "should be nil")
+
+	// Test burst is taken then refilled
+	remaining, ok, err := s.TakeToken("ip:1", 10, 2)
+	assert.Nil(t, err, "should be nil")
+	assert.Equal(t, true, ok, "should be true")
+	assert.Equal(t, true, remaining >= 1 && remaining < 1.1, "should be true")
+	_, ok, _ = s.TakeToken("ip:1", 10, 2)
+	assert.Equal(t, true, ok, "should be true")
+	remaining, ok, _ = s.TakeToken("ip:1", 10, 2)
+	assert.Equal(t, false, ok, "should be false")
+	assert.Equal(t, true, remaining < 1, "should be true")
+	_, ok, _ = s.TakeToken("ip:2", 10, 2)
+	assert.Equal(t, true, ok, "should be true")
+	time.Sleep(150 * time.Millisecond)
+	_, ok, _ = s.TakeToken("ip:1", 10, 2)
+	assert.Equal(t, true, ok, "should be true")
+
+	// Test concurrent takes share the bucket
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := s.TakeToken("ip:3", 0.001, 5)
+			assert.Nil(t, err, "should be nil")
+			if ok {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, taken, "should be equal")
+}
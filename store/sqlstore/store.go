@@ -0,0 +1,131 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	"github.com/mikunalpha/httpsrvtpl/store"
+)
+
+// logger is the logger of the store component.
+var logger = logging.Component(logging.ComponentStore)
+
+// Config contains the settings of the database connection.
+type Config struct {
+	// Driver is "postgres" or "sqlite3".
+	Driver string
+	// DSN is the data source name passed to the driver.
+	DSN string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// PingRetries is how many times to retry pinging the database when starting.
+	PingRetries int
+	// PingBackoff is the wait before the first retry. It is doubled after each retry.
+	PingBackoff time.Duration
+}
+
+// New opens the database and pings it with retry. It returns store.ErrConnectionFailed if
+// the database can not be reached.
+func New(cfg Config) (store.Store, error) {
+	switch cfg.Driver {
+	case "postgres", "sqlite3":
+	default:
+		return nil, fmt.Errorf("unknow sql driver %s", cfg.Driver)
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	backoff := cfg.PingBackoff
+	for i := 0; ; i++ {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		if i >= cfg.PingRetries {
+			logger.Errorf("ping %s failed: %v", cfg.Driver, err)
+			db.Close()
+			return nil, store.ErrConnectionFailed
+		}
+		logger.Warnf("ping %s failed: %v, retry in %s", cfg.Driver, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	s := &Store{
+		db:     db,
+		driver: cfg.Driver,
+	}
+	return s, nil
+}
+
+// Store is a database/sql implementation of store.Store.
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// Ping is a implementation of func store.Store.Ping. Try to touch the connected database.
+func (s *Store) Ping(ctx context.Context) error {
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		logger.Debugf("ping %s failed: %v", s.driver, err)
+		return store.ErrConnectionFailed
+	}
+	return nil
+}
+
+// Close is a implementation of func store.Store.Close.
+func (s *Store) Close() {
+	err := s.db.Close()
+	if err != nil {
+		logger.Errorf("close %s failed: %v", s.driver, err)
+	}
+}
+
+// translateError translates the errors of drivers into the errors of package store.
+// Methods of Store should return errors of queries through it.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	if err == driver.ErrBadConn {
+		return store.ErrConnectionFailed
+	}
+
+	switch e := err.(type) {
+	case *pq.Error:
+		if e.Code == "23505" {
+			return store.ErrDuplicate
+		}
+		// Class 08 is connection exception
+		if e.Code.Class() == "08" {
+			return store.ErrConnectionFailed
+		}
+	case sqlite3.Error:
+		if e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return store.ErrDuplicate
+		}
+		if e.Code == sqlite3.ErrCantOpen {
+			return store.ErrConnectionFailed
+		}
+	}
+	return err
+}
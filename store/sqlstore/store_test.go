@@ -0,0 +1,69 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mikunalpha/httpsrvtpl/logging"
+	"github.com/mikunalpha/httpsrvtpl/store"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.SetOutput(os.Stdout)
+	logging.SetLevel(log.PanicLevel)
+}
+
+func TestStore(t *testing.T) {
+	// Test unknown driver
+	_, err := New(Config{Driver: "mysql"})
+	assert.NotNil(t, err, "should not be nil")
+
+	// Test ping retry with backoff
+	start := time.Now()
+	_, err = New(Config{
+		Driver:      "sqlite3",
+		DSN:         "file:" + filepath.Join(os.TempDir(), "none", "none.db") + "?mode=ro",
+		PingRetries: 2,
+		PingBackoff: 50 * time.Millisecond,
+	})
+	assert.Equal(t, store.ErrConnectionFailed, err, "should be equal")
+	assert.Equal(t, true, time.Since(start) >= 150*time.Millisecond, "should be true")
+
+	// Test Ping and Close
+	st, err := New(Config{Driver: "sqlite3", DSN: ":memory:", MaxOpenConns: 1, MaxIdleConns: 1})
+	assert.Nil(t, err, "should be nil")
+	assert.Nil(t, st.Ping(context.Background()), "should be nil")
+	db := st.(*Store).db
+
+	// Test translateError
+	_, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT UNIQUE)")
+	assert.Nil(t, err, "should be nil")
+	_, err = db.Exec("INSERT INTO users (id, name) VALUES (1, 'mikun')")
+	assert.Nil(t, err, "should be nil")
+	_, err = db.Exec("INSERT INTO users (id, name) VALUES (2, 'mikun')")
+	assert.Equal(t, store.ErrDuplicate, translateError(err), "should be equal")
+	_, err = db.Exec("INSERT INTO users (id, name) VALUES (1, 'other')")
+	assert.Equal(t, store.ErrDuplicate, translateError(err), "should be equal")
+	var name string
+	err = db.QueryRow("SELECT name FROM users WHERE id = 3").Scan(&name)
+	assert.Equal(t, store.ErrNotFound, translateError(err), "should be equal")
+	assert.Nil(t, translateError(nil), "should be nil")
+	assert.Equal(t, store.ErrNotFound, translateError(sql.ErrNoRows), "should be equal")
+	assert.Equal(t, store.ErrConnectionFailed, translateError(driver.ErrBadConn), "should be equal")
+	assert.Equal(t, store.ErrDuplicate, translateError(&pq.Error{Code: "23505"}), "should be equal")
+	assert.Equal(t, store.ErrConnectionFailed, translateError(&pq.Error{Code: "08006"}), "should be equal")
+	other := errors.New("other")
+	assert.Equal(t, other, translateError(other), "should be equal")
+
+	st.Close()
+	assert.Equal(t, store.ErrConnectionFailed, st.Ping(context.Background()), "should be equal")
+}
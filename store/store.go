@@ -1,6 +1,9 @@
 package store
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 var (
 	// ErrNotFound indicates wanted data is not found.
@@ -13,6 +16,16 @@ var (
 
 // Store is a data store interface.
 type Store interface {
-	Ping() error
+	// Ping touches the connected database. It returns when ctx is done.
+	Ping(ctx context.Context) error
 	Close()
 }
+
+// RateLimiter is implemented by stores which keep token buckets shared by server
+// instances.
+type RateLimiter interface {
+	// TakeToken refills the bucket of key by rate tokens per second up to burst, then
+	// takes a token if there is one. It returns the tokens left and whether a token is
+	// taken.
+	TakeToken(key string, rate float64, burst int) (remaining float64, ok bool, err error)
+}